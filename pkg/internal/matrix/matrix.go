@@ -0,0 +1,108 @@
+// Package matrix shares one started container per image tag between tests.
+// The provider packages wrap it in a Matrix typed with their own container.
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Container is a started container the Matrix terminates.
+type Container interface {
+	Terminate(ctx context.Context) error
+}
+
+// StartFunc starts the container for tag.
+type StartFunc func(ctx context.Context, tag string) (Container, error)
+
+// Matrix starts one Container per tag the first time it is needed and shares it afterwards.
+type Matrix struct {
+	tags  []string
+	start StartFunc
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	mu  sync.Mutex
+	con Container
+}
+
+// New creates a Matrix for the given tags that starts containers with start.
+func New(tags []string, start StartFunc) *Matrix {
+	return &Matrix{
+		tags:    tags,
+		start:   start,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Run calls fn once per tag in a subtest named after the tag.
+func (m *Matrix) Run(t *testing.T, fn func(t *testing.T, tag string)) {
+	for _, tag := range m.tags {
+		tag := tag
+		t.Run(tag, func(t *testing.T) {
+			fn(t, tag)
+		})
+	}
+}
+
+// Container returns the shared Container for tag, starting it if necessary.
+func (m *Matrix) Container(ctx context.Context, tag string) (Container, error) {
+	m.mu.Lock()
+	e, exists := m.entries[tag]
+	if !exists {
+		e = &entry{}
+		m.entries[tag] = e
+	}
+	m.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Only a started Container is kept, so the next call retries a failed start.
+	if e.con == nil {
+		con, err := m.start(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		e.con = con
+	}
+
+	return e.con, nil
+}
+
+// ContainerForTest returns the shared Container for tag and fails t if it cannot be started.
+func (m *Matrix) ContainerForTest(t *testing.T, ctx context.Context, tag string) Container {
+	con, err := m.Container(ctx, tag)
+	if err != nil {
+		t.Fatalf("error starting container for tag %s: %s", tag, err.Error())
+	}
+	return con
+}
+
+// Terminate terminates every Container started by the Matrix. Every Container is terminated even if another fails
+// to, the first error is returned. Containers are started again if the Matrix is used afterwards.
+func (m *Matrix) Terminate(ctx context.Context) error {
+	m.mu.Lock()
+	entries := m.entries
+	m.entries = make(map[string]*entry)
+	m.mu.Unlock()
+
+	var firstErr error
+	for tag, e := range entries {
+		e.mu.Lock()
+		if e.con != nil {
+			if err := e.con.Terminate(ctx); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("error terminating container for tag %s: %w", tag, err)
+			}
+			e.con = nil
+		}
+		e.mu.Unlock()
+	}
+
+	return firstErr
+}
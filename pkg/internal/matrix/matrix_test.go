@@ -0,0 +1,89 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeContainer struct {
+	tag          string
+	terminated   bool
+	terminateErr error
+}
+
+func (f *fakeContainer) Terminate(ctx context.Context) error {
+	f.terminated = true
+	return f.terminateErr
+}
+
+func TestMatrix(t *testing.T) {
+	t.Run("runs every tag", func(t *testing.T) {
+		m := New([]string{"1", "2"}, func(ctx context.Context, tag string) (Container, error) {
+			return &fakeContainer{tag: tag}, nil
+		})
+
+		var tags []string
+		m.Run(t, func(t *testing.T, tag string) {
+			con := m.ContainerForTest(t, context.Background(), tag)
+			tags = append(tags, con.(*fakeContainer).tag)
+		})
+		assert.Equal(t, []string{"1", "2"}, tags)
+	})
+	t.Run("shares containers", func(t *testing.T) {
+		starts := 0
+		m := New([]string{"1"}, func(ctx context.Context, tag string) (Container, error) {
+			starts++
+			return &fakeContainer{tag: tag}, nil
+		})
+
+		first, err := m.Container(context.Background(), "1")
+		assert.NoError(t, err)
+		second, err := m.Container(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+		assert.Equal(t, 1, starts)
+	})
+	t.Run("retries failed starts", func(t *testing.T) {
+		fail := true
+		m := New([]string{"1"}, func(ctx context.Context, tag string) (Container, error) {
+			if fail {
+				return nil, errors.New("no docker")
+			}
+			return &fakeContainer{tag: tag}, nil
+		})
+
+		_, err := m.Container(context.Background(), "1")
+		assert.Error(t, err)
+
+		fail = false
+		con, err := m.Container(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.NotNil(t, con)
+	})
+	t.Run("terminates every container", func(t *testing.T) {
+		cons := map[string]*fakeContainer{
+			"1": {tag: "1", terminateErr: errors.New("stuck")},
+			"2": {tag: "2"},
+		}
+		m := New([]string{"1", "2"}, func(ctx context.Context, tag string) (Container, error) {
+			return cons[tag], nil
+		})
+		for tag := range cons {
+			_, err := m.Container(context.Background(), tag)
+			assert.NoError(t, err)
+		}
+
+		err := m.Terminate(context.Background())
+		assert.EqualError(t, err, "error terminating container for tag 1: stuck")
+		assert.True(t, cons["1"].terminated)
+		assert.True(t, cons["2"].terminated)
+
+		cons["2"] = &fakeContainer{tag: "2"}
+		con, err := m.Container(context.Background(), "2")
+		assert.NoError(t, err)
+		assert.Same(t, cons["2"], con, "containers are started again after Terminate")
+	})
+}
@@ -0,0 +1,46 @@
+// Package testutil contains helpers shared by the tests of the testdeps packages.
+package testutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RecordingTB records the errors reported to it instead of failing the test, so expectations can be tested to fail.
+// Every other method is forwarded to the embedded testing.TB.
+type RecordingTB struct {
+	testing.TB
+
+	mu       sync.Mutex
+	messages []string
+}
+
+// Error records args formatted as by fmt.Sprintln.
+func (r *RecordingTB) Error(args ...interface{}) {
+	r.record(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Errorf records args formatted as by fmt.Sprintf.
+func (r *RecordingTB) Errorf(format string, args ...interface{}) {
+	r.record(fmt.Sprintf(format, args...))
+}
+
+// Failed reports whether an error has been recorded.
+func (r *RecordingTB) Failed() bool {
+	return len(r.Messages()) > 0
+}
+
+// Messages returns the recorded errors in the order they were reported.
+func (r *RecordingTB) Messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.messages...)
+}
+
+func (r *RecordingTB) record(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+}
@@ -0,0 +1,19 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordingTB(t *testing.T) {
+	rec := &RecordingTB{TB: t}
+	assert.False(t, rec.Failed())
+
+	rec.Errorf("expected %d, got %d", 1, 2)
+	rec.Error("missing", "file")
+
+	assert.True(t, rec.Failed())
+	assert.Equal(t, []string{"expected 1, got 2", "missing file"}, rec.Messages())
+	assert.False(t, t.Failed(), "errors are not reported to the test")
+}
@@ -0,0 +1,266 @@
+package testmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Watchable is anything a change stream can be opened on, i.e., *mongo.Collection, *mongo.Database or *mongo.Client.
+type Watchable interface {
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// ChangeEvent is a single change event received by a ChangeStreamWatcher.
+type ChangeEvent struct {
+	// OperationType is the kind of change, e.g., `insert`, `update`, `replace` or `delete`.
+	OperationType string `bson:"operationType"`
+	Namespace     struct {
+		Database   string `bson:"db"`
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey bson.Raw `bson:"documentKey"`
+	// FullDocument is the document after the change. It is empty for deletes.
+	FullDocument      bson.Raw `bson:"fullDocument"`
+	UpdateDescription bson.Raw `bson:"updateDescription"`
+	// Raw is the complete change event as sent by the server.
+	Raw bson.Raw `bson:"-"`
+}
+
+// ChangeStreamWatcher opens a change stream and buffers every event it receives.
+// Use the Expect... methods to assert on changes instead of sleeping.
+// Change streams require a replica set, e.g., a Container started with WithReplicaSet.
+type ChangeStreamWatcher struct {
+	stream *mongo.ChangeStream
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	received []ChangeEvent
+	pending  []ChangeEvent
+	changed  chan struct{}
+	done     chan struct{}
+	stopped  bool
+	err      error
+}
+
+// NewChangeStreamWatcher opens a change stream on target that is filtered by the optional aggregation pipeline.
+// The watcher must be closed by the caller.
+// A default context is used with a timeout of two minutes. To customize use NewChangeStreamWatcherWithContext.
+func NewChangeStreamWatcher(target Watchable, pipeline ...bson.D) (*ChangeStreamWatcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return NewChangeStreamWatcherWithContext(ctx, target, pipeline...)
+}
+
+// NewChangeStreamWatcherWithContext opens a change stream on target that is filtered by the optional aggregation pipeline.
+// The watcher must be closed by the caller.
+// Events for changes made after NewChangeStreamWatcherWithContext returns are guaranteed to be recorded.
+func NewChangeStreamWatcherWithContext(ctx context.Context, target Watchable, pipeline ...bson.D) (*ChangeStreamWatcher, error) {
+	if pipeline == nil {
+		pipeline = []bson.D{}
+	}
+
+	stream, err := target.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return nil, err
+	}
+
+	/// The stream outlives ctx, which usually only bounds opening it.
+	recordCtx, cancel := context.WithCancel(context.Background())
+	w := &ChangeStreamWatcher{
+		stream:  stream,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.record(recordCtx)
+
+	return w, nil
+}
+
+// NewTestChangeStreamWatcher opens a change stream on target that is filtered by the optional aggregation pipeline.
+// The watcher is automatically closed after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func NewTestChangeStreamWatcher(t testing.TB, target Watchable, pipeline ...bson.D) (*ChangeStreamWatcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return NewTestChangeStreamWatcherWithContext(t, ctx, target, pipeline...)
+}
+
+// NewTestChangeStreamWatcherWithContext opens a change stream on target that is filtered by the optional aggregation pipeline.
+// The watcher is automatically closed after the test finishes.
+func NewTestChangeStreamWatcherWithContext(t testing.TB, ctx context.Context, target Watchable, pipeline ...bson.D) (*ChangeStreamWatcher, error) {
+	w, err := NewChangeStreamWatcherWithContext(ctx, target, pipeline...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return w, nil
+}
+
+// Events returns every event received so far, including those already matched by an expectation.
+func (w *ChangeStreamWatcher) Events() []ChangeEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]ChangeEvent(nil), w.received...)
+}
+
+// WaitForChange blocks until an event matching operationType, collection and fields is received.
+// An empty operationType or collection matches any. fields are compared by value against the full document,
+// or the document key for deletes, and may use dotted paths, e.g., bson.D{{Key: "status", Value: "paid"}}.
+// The matched event is consumed so consecutive calls match distinct events.
+func (w *ChangeStreamWatcher) WaitForChange(ctx context.Context, operationType, collection string, fields bson.D) (ChangeEvent, error) {
+	for {
+		e, found, changed, err := w.take(operationType, collection, fields)
+		if found {
+			return e, nil
+		}
+		if err != nil {
+			return ChangeEvent{}, err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ChangeEvent{}, fmt.Errorf("no %q event on collection %q matching %s: %w", operationType, collection, formatDocument(fields), ctx.Err())
+		}
+	}
+}
+
+// ExpectChange fails t unless an event matching operationType, collection and fields is received within timeout,
+// e.g., ExpectChange(t, "insert", "orders", bson.D{{Key: "status", Value: "paid"}}, 2*time.Second).
+// The matched event is consumed so consecutive calls match distinct events.
+func (w *ChangeStreamWatcher) ExpectChange(t testing.TB, operationType, collection string, fields bson.D, timeout time.Duration) ChangeEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	e, err := w.WaitForChange(ctx, operationType, collection, fields)
+	if err != nil {
+		t.Errorf("expected change within %s: %s", timeout, err.Error())
+	}
+	return e
+}
+
+// ExpectNoChange fails t if any unmatched event is received within the given duration.
+func (w *ChangeStreamWatcher) ExpectNoChange(t testing.TB, within time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), within)
+	defer cancel()
+
+	if e, err := w.WaitForChange(ctx, "", "", nil); err == nil {
+		t.Errorf("expected no further changes, got %q on collection %q", e.OperationType, e.Namespace.Collection)
+	}
+}
+
+// Close closes the change stream.
+func (w *ChangeStreamWatcher) Close() error {
+	w.cancel()
+	<-w.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	if err := w.stream.Close(ctx); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *ChangeStreamWatcher) record(ctx context.Context) {
+	defer close(w.done)
+
+	for w.stream.Next(ctx) {
+		var e ChangeEvent
+		err := w.stream.Decode(&e)
+		e.Raw = append(bson.Raw(nil), w.stream.Current...)
+
+		w.mu.Lock()
+		if err != nil {
+			w.err = err
+		} else {
+			w.received = append(w.received, e)
+			w.pending = append(w.pending, e)
+		}
+		close(w.changed)
+		w.changed = make(chan struct{})
+		w.mu.Unlock()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.stream.Err(); err != nil && ctx.Err() == nil && w.err == nil {
+		w.err = err
+	}
+	w.stopped = true
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// take removes and returns the first pending event that matches.
+// If none matches it returns a channel that is closed when the next event arrives,
+// or the error that stopped the stream.
+func (w *ChangeStreamWatcher) take(operationType, collection string, fields bson.D) (e ChangeEvent, found bool, changed <-chan struct{}, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, pending := range w.pending {
+		if pending.matches(operationType, collection, fields) {
+			w.pending = append(w.pending[:i], w.pending[i+1:]...)
+			return pending, true, nil, nil
+		}
+	}
+
+	if w.stopped {
+		if w.err != nil {
+			return ChangeEvent{}, false, nil, w.err
+		}
+		return ChangeEvent{}, false, nil, errors.New("change stream is closed")
+	}
+
+	return ChangeEvent{}, false, w.changed, nil
+}
+
+func (e ChangeEvent) matches(operationType, collection string, fields bson.D) bool {
+	if operationType != "" && e.OperationType != operationType {
+		return false
+	}
+	if collection != "" && e.Namespace.Collection != collection {
+		return false
+	}
+
+	doc := e.FullDocument
+	if len(doc) == 0 {
+		doc = e.DocumentKey
+	}
+
+	for _, field := range fields {
+		value, err := doc.LookupErr(strings.Split(field.Key, ".")...)
+		if err != nil {
+			return false
+		}
+		if !sameDocument(bson.D{{Key: "v", Value: field.Value}}, bson.D{{Key: "v", Value: value}}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangeEvent_Matches(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{{Key: "status", Value: "paid"}, {Key: "total", Value: 10}, {Key: "customer", Value: bson.D{{Key: "id", Value: "c1"}}}})
+	assert.NoError(t, err)
+
+	e := ChangeEvent{OperationType: "insert", FullDocument: doc}
+	e.Namespace.Collection = "orders"
+
+	assert.True(t, e.matches("", "", nil))
+	assert.True(t, e.matches("insert", "orders", bson.D{{Key: "status", Value: "paid"}}))
+	assert.True(t, e.matches("insert", "orders", bson.D{{Key: "total", Value: 10.0}}))
+	assert.True(t, e.matches("insert", "orders", bson.D{{Key: "customer.id", Value: "c1"}}))
+	assert.False(t, e.matches("update", "orders", nil))
+	assert.False(t, e.matches("insert", "customers", nil))
+	assert.False(t, e.matches("insert", "orders", bson.D{{Key: "status", Value: "pending"}}))
+	assert.False(t, e.matches("insert", "orders", bson.D{{Key: "missing", Value: true}}))
+}
+
+func TestChangeStreamWatcher(t *testing.T) {
+	t.Parallel()
+	con, err := RunTest(t, WithReplicaSet())
+	assert.NoError(t, err)
+
+	t.Run("expect change", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+		orders := db.Collection("orders")
+
+		w, err := NewTestChangeStreamWatcher(t, orders)
+		assert.NoError(t, err)
+
+		_, err = orders.InsertOne(ctx, bson.D{{Key: "_id", Value: "o1"}, {Key: "status", Value: "pending"}})
+		assert.NoError(t, err)
+		_, err = orders.UpdateByID(ctx, "o1", bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "paid"}}}})
+		assert.NoError(t, err)
+
+		e := w.ExpectChange(t, "update", "orders", bson.D{{Key: "status", Value: "paid"}}, 2*time.Second)
+		assert.Equal(t, "update", e.OperationType)
+		w.ExpectChange(t, "insert", "orders", bson.D{{Key: "_id", Value: "o1"}}, 2*time.Second)
+		w.ExpectNoChange(t, 500*time.Millisecond)
+		assert.Len(t, w.Events(), 2)
+	})
+	t.Run("watches databases", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		w, err := NewTestChangeStreamWatcher(t, db)
+		assert.NoError(t, err)
+
+		_, err = db.Collection("customers").InsertOne(ctx, bson.D{{Key: "_id", Value: "c1"}})
+		assert.NoError(t, err)
+		_, err = db.Collection("customers").DeleteOne(ctx, bson.D{{Key: "_id", Value: "c1"}})
+		assert.NoError(t, err)
+
+		w.ExpectChange(t, "delete", "customers", bson.D{{Key: "_id", Value: "c1"}}, 2*time.Second)
+	})
+	t.Run("reports missing changes", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		w, err := NewTestChangeStreamWatcher(t, db.Collection("orders"))
+		assert.NoError(t, err)
+
+		rec := &testutil.RecordingTB{TB: t}
+		w.ExpectChange(rec, "insert", "orders", nil, 200*time.Millisecond)
+		if assert.Len(t, rec.Messages(), 1) {
+			assert.Contains(t, rec.Messages()[0], `expected change within 200ms: no "insert" event on collection "orders"`)
+		}
+	})
+	t.Run("requires a replica set", func(t *testing.T) {
+		standalone, _ := RunTest(t)
+		db, err := standalone.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		_, err = NewChangeStreamWatcher(db.Collection("orders"))
+		assert.Error(t, err)
+	})
+}
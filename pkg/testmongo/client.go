@@ -2,7 +2,10 @@ package testmongo
 
 import (
 	"context"
+	"errors"
 	"github.com/kyleishie/testdeps/pkg/common"
+	"os"
+	"sync"
 	"testing"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,8 +22,8 @@ func (c *Container) NewClient() (*mongo.Client, error) {
 // The connection is tested once before returning the new client.
 // NewClientWithContext exists to allow you to customize the connection process, e.g., apply timeout.
 func (c *Container) NewClientWithContext(ctx context.Context) (*mongo.Client, error) {
-	clientOptions := options.Client().ApplyURI(c.ConnectionString)
-	client, err := mongo.Connect(ctx, clientOptions)
+	clientOptions := append([]*options.ClientOptions{options.Client().ApplyURI(c.ConnectionString)}, c.clientOptions...)
+	client, err := mongo.Connect(ctx, clientOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +36,122 @@ func (c *Container) NewClientWithContext(ctx context.Context) (*mongo.Client, er
 	return client, nil
 }
 
+// WithClientOptions returns a copy of the Container whose clients are created with the given options.
+// The options are applied after the connection string, so they take precedence over it.
+// Every helper of the copy, e.g., NewTestDatabase, uses the options.
+func (c *Container) WithClientOptions(opts ...*options.ClientOptions) *Container {
+	con := *c
+	con.clientOptions = append(append([]*options.ClientOptions{}, c.clientOptions...), opts...)
+	con.shared = &sharedClient{}
+	return &con
+}
+
+// WithSharedClient returns a copy of the Container whose databases, e.g., from NewTestDatabase, all use the SharedClient
+// instead of a new mongo.Client each. Cleanup drops test databases but leaves the SharedClient connected.
+// Large parallel suites should prefer it to avoid opening a connection pool per database.
+func (c *Container) WithSharedClient() *Container {
+	con := *c
+	con.useSharedClient = true
+	return &con
+}
+
+// SharedClient returns a mongo.Client that is created on first use and shared by every caller.
+// It is disconnected when the Container is terminated, so it must not be disconnected by the caller.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) SharedClient() (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.SharedClientWithContext(ctx)
+}
+
+// SharedClientWithContext returns a mongo.Client that is created on first use and shared by every caller.
+// It is disconnected when the Container is terminated, so it must not be disconnected by the caller.
+// Copies of the Container that connect differently, e.g., from WithClientOptions or AsUser, have their own shared client.
+func (c *Container) SharedClientWithContext(ctx context.Context) (*mongo.Client, error) {
+	if c.shared == nil || c.sharedClients == nil {
+		return nil, errors.New("shared clients are only available for containers created by Run")
+	}
+
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+
+	if c.shared.client != nil {
+		return c.shared.client, nil
+	}
+
+	client, err := c.NewClientWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sharedClients.add(client)
+	c.shared.client = client
+	return client, nil
+}
+
+// Terminate disconnects every shared client of the Container and its copies, then terminates the docker container.
+// Certificate files of a Container started with WithTLS are removed as well.
+func (c *Container) Terminate(ctx context.Context) error {
+	if c.sharedClients != nil {
+		if err := c.sharedClients.disconnect(ctx); err != nil {
+			return err
+		}
+	}
+	if c.tls != nil {
+		if err := os.RemoveAll(c.tls.dir); err != nil {
+			return err
+		}
+	}
+	return c.Container.Terminate(ctx)
+}
+
+// databaseClient returns the client databases are created from, which must be released with releaseDatabaseClient.
+func (c *Container) databaseClient(ctx context.Context) (*mongo.Client, error) {
+	if c.useSharedClient {
+		return c.SharedClientWithContext(ctx)
+	}
+	return c.NewClientWithContext(ctx)
+}
+
+// releaseDatabaseClient disconnects a client returned by databaseClient unless it is the shared client.
+func (c *Container) releaseDatabaseClient(ctx context.Context, client *mongo.Client) error {
+	if c.useSharedClient {
+		return nil
+	}
+	return client.Disconnect(ctx)
+}
+
+// sharedClient is the lazily created client shared by a Container and the copies that connect the same way.
+type sharedClient struct {
+	mu     sync.Mutex
+	client *mongo.Client
+}
+
+// sharedClients tracks every shared client of a Container and its copies so they can be disconnected on termination.
+type sharedClients struct {
+	mu      sync.Mutex
+	clients []*mongo.Client
+}
+
+func (s *sharedClients) add(client *mongo.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients = append(s.clients, client)
+}
+
+func (s *sharedClients) disconnect(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, client := range s.clients {
+		if err := client.Disconnect(ctx); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+			return err
+		}
+	}
+	s.clients = nil
+	return nil
+}
+
 // NewTestClient creates a mongo.Client for testing purposes.
 // The mongo.Client will be disconnected automatically after the test finishes.
 // Note: A default context is used with a timeout of two minutes.
@@ -6,6 +6,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestContainer_NewClient(t *testing.T) {
@@ -108,3 +111,53 @@ func TestContainer_NewTestClientWithContext(t *testing.T) {
 	})
 
 }
+
+func TestContainer_SharedClient(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	t.Run("is created once", func(t *testing.T) {
+		first, err := con.SharedClient()
+		assert.NoError(t, err)
+		second, err := con.SharedClient()
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+	t.Run("copies that connect differently have their own", func(t *testing.T) {
+		shared, err := con.SharedClient()
+		assert.NoError(t, err)
+		other, err := con.WithClientOptions(options.Client().SetAppName("other")).SharedClient()
+		assert.NoError(t, err)
+		assert.NotSame(t, shared, other)
+	})
+	t.Run("test databases use the shared client", func(t *testing.T) {
+		shared, err := con.SharedClient()
+		assert.NoError(t, err)
+
+		var db *mongo.Database
+		t.Run("database", func(t *testing.T) {
+			db, err = con.WithSharedClient().NewTestDatabase(t)
+			assert.NoError(t, err)
+			assert.Same(t, shared, db.Client())
+			_, err = db.Collection("orders").InsertOne(context.Background(), bson.D{{Key: "status", Value: "paid"}})
+			assert.NoError(t, err)
+		})
+
+		/// The database is dropped but the shared client is still connected.
+		ctx := context.Background()
+		assert.NoError(t, shared.Ping(ctx, nil))
+		names, err := shared.ListDatabaseNames(ctx, bson.D{{Key: "name", Value: db.Name()}})
+		assert.NoError(t, err)
+		assert.Empty(t, names)
+	})
+	t.Run("disconnected on termination", func(t *testing.T) {
+		ctx := context.Background()
+		con, err := Run()
+		assert.NoError(t, err)
+		shared, err := con.SharedClient()
+		assert.NoError(t, err)
+
+		assert.NoError(t, con.Terminate(ctx))
+		assert.ErrorIs(t, shared.Ping(ctx, nil), mongo.ErrClientDisconnected)
+	})
+}
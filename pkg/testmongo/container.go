@@ -7,6 +7,8 @@ import (
 	"github.com/kyleishie/testdeps/pkg/options"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	mongooptions "go.mongodb.org/mongo-driver/mongo/options"
+	"os"
 	"testing"
 )
 
@@ -15,11 +17,20 @@ const (
 	mappedPort = "27017/tcp"
 	readyLog   = "Waiting for connections"
 	proto      = "mongodb"
+
+	// entrypoint writes the files mongod needs from the environment, then hands off to the standard mongo entrypoint.
+	entrypoint = keyFileScript + tlsScript + `exec docker-entrypoint.sh "$@"`
 )
 
 type Container struct {
 	tc.Container
 	ConnectionString string
+	clientOptions    []*mongooptions.ClientOptions
+	databaseSetups   []DatabaseSetup
+	useSharedClient  bool
+	shared           *sharedClient
+	sharedClients    *sharedClients
+	tls              *containerTLS
 }
 
 // Run creates and starts a docker Container with the `mongo` image.
@@ -40,6 +51,33 @@ func RunWithContext(ctx context.Context, opts ...options.Option) (con *Container
 		return
 	}
 
+	con, err = startContainer(ctx, cReq)
+	if err != nil {
+		return
+	}
+
+	if name, exists := replicaSetName(cReq); exists {
+		if err = initiateReplicaSet(ctx, con.ConnectionString, name); err != nil {
+			_ = con.Terminate(ctx)
+			con = nil
+		}
+	}
+
+	return
+}
+
+// startContainer starts a container for the given request and builds its connection string.
+func startContainer(ctx context.Context, cReq tc.ContainerRequest) (con *Container, err error) {
+	certs, err := newContainerTLS(&cReq)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil && certs != nil {
+			_ = os.RemoveAll(certs.dir)
+		}
+	}()
+
 	c, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
 		ContainerRequest: cReq,
 		Started:          true,
@@ -55,9 +93,17 @@ func RunWithContext(ctx context.Context, opts ...options.Option) (con *Container
 	}
 
 	con = &Container{
-		Container:        c,
-		ConnectionString: fmt.Sprintf("%s://%s%s:%d", proto, makeRootUserPrefix(cReq), host, port.Int()),
+		Container:     c,
+		shared:        &sharedClient{},
+		sharedClients: &sharedClients{},
+		tls:           certs,
+	}
+
+	var caFile string
+	if certs != nil {
+		caFile = certs.caFile
 	}
+	con.ConnectionString = fmt.Sprintf("%s://%s%s:%d%s", proto, makeRootUserPrefix(cReq), host, port.Int(), makeConnectionStringOptions(cReq, caFile))
 
 	return
 }
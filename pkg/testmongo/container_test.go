@@ -338,3 +338,24 @@ func TestMakeRootUserPrefix(t *testing.T) {
 	authStr := makeRootUserPrefix(cReq)
 	assert.Equal(t, expectation, authStr)
 }
+
+func TestMakeConnectionStringOptions(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		assert.Empty(t, makeConnectionStringOptions(tc.ContainerRequest{}, ""))
+	})
+	t.Run("replica set", func(t *testing.T) {
+		cReq := tc.ContainerRequest{
+			Cmd: []string{"--replSet", "rs0"},
+		}
+		assert.Equal(t, "/?replicaSet=rs0&directConnection=true", makeConnectionStringOptions(cReq, ""))
+	})
+	t.Run("tls", func(t *testing.T) {
+		assert.Equal(t, "/?tls=true&tlsCAFile=%2Ftmp%2Fca.pem", makeConnectionStringOptions(tc.ContainerRequest{}, "/tmp/ca.pem"))
+	})
+	t.Run("replica set with tls", func(t *testing.T) {
+		cReq := tc.ContainerRequest{
+			Cmd: []string{"--replSet", "rs0"},
+		}
+		assert.Equal(t, "/?replicaSet=rs0&directConnection=true&tls=true&tlsCAFile=%2Ftmp%2Fca.pem", makeConnectionStringOptions(cReq, "/tmp/ca.pem"))
+	})
+}
@@ -9,7 +9,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// DatabaseSetup prepares a newly created database, e.g., by creating collections and indexes.
+type DatabaseSetup func(ctx context.Context, db *mongo.Database) error
+
 // NewDatabase creates a new mongo client then a new database with then given name and options.
+// Containers from WithSharedClient use the SharedClient instead of a new mongo client.
 func (c *Container) NewDatabase(name string, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
 	return c.NewDatabaseWithContext(context.Background(), name, opts...)
 }
@@ -17,11 +21,29 @@ func (c *Container) NewDatabase(name string, opts ...*options.DatabaseOptions) (
 // NewDatabaseWithContext creates a new mongo.Database with then given name and options.
 // NewDatabaseWithContext exists to allow you to customize the connection process, e.g., apply timeout.
 func (c *Container) NewDatabaseWithContext(ctx context.Context, name string, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
-	client, err := c.NewClientWithContext(ctx)
+	client, err := c.databaseClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return client.Database(name, opts...), nil
+
+	db := client.Database(name, opts...)
+	for _, setup := range c.databaseSetups {
+		if err := setup(ctx, db); err != nil {
+			_ = db.Drop(ctx)
+			_ = c.releaseDatabaseClient(ctx, client)
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// WithDatabaseSetup returns a copy of the Container that runs the given setups, in order, on every database it creates.
+// Every helper of the copy, e.g., NewTestDatabase, returns databases that are already set up.
+func (c *Container) WithDatabaseSetup(setups ...DatabaseSetup) *Container {
+	con := *c
+	con.databaseSetups = append(append([]DatabaseSetup{}, c.databaseSetups...), setups...)
+	return &con
 }
 
 // NewTestDatabase creates a new Database with a random name within the Container.
@@ -36,6 +58,7 @@ func (c *Container) NewTestDatabase(t testing.TB, opts ...*options.DatabaseOptio
 // NewTestDatabaseWithContext creates a new mongo.Database with a random name within the Container.
 // The database will be named randomly.
 // The database is automatically dropped and the underlying mongo.Client will be disconnected after to test it finished.
+// Containers from WithSharedClient leave the SharedClient connected.
 func (c *Container) NewTestDatabaseWithContext(t testing.TB, ctx context.Context, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
 	name := common.GenerateId()
 
@@ -44,16 +67,20 @@ func (c *Container) NewTestDatabaseWithContext(t testing.TB, ctx context.Context
 		return nil, err
 	}
 
+	c.dropOnCleanup(t, db)
+	return db, err
+}
+
+// dropOnCleanup drops db and releases its client after the test finishes.
+func (c *Container) dropOnCleanup(t testing.TB, db *mongo.Database) {
 	t.Cleanup(func() {
 		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
 		defer cancel()
 		if err := db.Drop(ctx); err != nil {
 			t.Error(err)
 		}
-		if err := db.Client().Disconnect(ctx); err != nil {
+		if err := c.releaseDatabaseClient(ctx, db.Client()); err != nil {
 			t.Error(err)
 		}
 	})
-
-	return db, err
 }
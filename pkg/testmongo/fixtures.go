@@ -0,0 +1,147 @@
+package testmongo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const fixtureExt = ".json"
+
+// LoadFixtures inserts the documents of every `<collection>.json` file at the root of fsys into the collection of the same name.
+// Files contain MongoDB Extended JSON, either as an array of documents or one document per line as written by mongoexport.
+// Use os.DirFS to load fixtures from a directory, e.g., os.DirFS("testdata/fixtures").
+// Note: A default context is used with a timeout of two minutes.
+func LoadFixtures(db *mongo.Database, fsys fs.FS) error {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return LoadFixturesWithContext(ctx, db, fsys)
+}
+
+// LoadFixturesWithContext inserts the documents of every `<collection>.json` file at the root of fsys into the collection of the same name.
+// Files contain MongoDB Extended JSON, either as an array of documents or one document per line as written by mongoexport.
+// Use os.DirFS to load fixtures from a directory, e.g., os.DirFS("testdata/fixtures").
+func LoadFixturesWithContext(ctx context.Context, db *mongo.Database, fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != fixtureExt {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+
+		docs, err := parseFixture(data)
+		if err != nil {
+			return fmt.Errorf("parsing fixture %s: %w", entry.Name(), err)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+
+		collection := strings.TrimSuffix(entry.Name(), fixtureExt)
+		if _, err := db.Collection(collection).InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("loading fixture %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// DumpCollection returns every document of collection, sorted by _id, as an array of canonical Extended JSON.
+// The output is stable so it can be compared against golden files and loaded again with LoadFixtures.
+// Note: A default context is used with a timeout of two minutes.
+func DumpCollection(collection *mongo.Collection) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return DumpCollectionWithContext(ctx, collection)
+}
+
+// DumpCollectionWithContext returns every document of collection, sorted by _id, as an array of canonical Extended JSON.
+// The output is stable so it can be compared against golden files and loaded again with LoadFixtures.
+func DumpCollectionWithContext(ctx context.Context, collection *mongo.Collection) ([]byte, error) {
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	for cursor.Next(ctx) {
+		docs = append(docs, append(bson.Raw(nil), cursor.Current...))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return formatFixture(docs)
+}
+
+// parseFixture parses an array of Extended JSON documents or one Extended JSON document per line.
+func parseFixture(data []byte) ([]interface{}, error) {
+	var raws []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var raw json.RawMessage
+			err := decoder.Decode(&raw)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			raws = append(raws, raw)
+		}
+	}
+
+	docs := make([]interface{}, 0, len(raws))
+	for _, raw := range raws {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// formatFixture formats docs as an array of canonical Extended JSON with one document per line.
+func formatFixture(docs []bson.Raw) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for i, doc := range docs {
+		ext, err := bson.MarshalExtJSON(doc, true, false)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("  ")
+		buf.Write(ext)
+		if i < len(docs)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package testmongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseFixture(t *testing.T) {
+	t.Run("array", func(t *testing.T) {
+		docs, err := parseFixture([]byte(`[{"a": 1}, {"a": 2}]`))
+		assert.NoError(t, err)
+		assert.Len(t, docs, 2)
+	})
+	t.Run("one document per line", func(t *testing.T) {
+		docs, err := parseFixture([]byte("{\"a\": 1}\n{\"a\": 2}\n"))
+		assert.NoError(t, err)
+		assert.Len(t, docs, 2)
+	})
+	t.Run("empty", func(t *testing.T) {
+		docs, err := parseFixture([]byte("  \n"))
+		assert.NoError(t, err)
+		assert.Empty(t, docs)
+	})
+	t.Run("extended types", func(t *testing.T) {
+		docs, err := parseFixture([]byte(`{"_id": {"$oid": "5f1e3b0c9d3b2a0001a1b2c3"}, "at": {"$date": "2020-07-27T02:25:16Z"}, "total": {"$numberDecimal": "19.99"}}`))
+		assert.NoError(t, err)
+		doc := docs[0].(bson.D).Map()
+		assert.IsType(t, primitive.ObjectID{}, doc["_id"])
+		assert.IsType(t, primitive.DateTime(0), doc["at"])
+		assert.IsType(t, primitive.Decimal128{}, doc["total"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseFixture([]byte(`{"a": `))
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatFixture(t *testing.T) {
+	docs, err := parseFixture([]byte(`{"_id": {"$oid": "5f1e3b0c9d3b2a0001a1b2c3"}, "total": {"$numberDecimal": "19.99"}}`))
+	assert.NoError(t, err)
+
+	raw, err := bson.Marshal(docs[0])
+	assert.NoError(t, err)
+
+	out, err := formatFixture([]bson.Raw{raw})
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n  {\"_id\":{\"$oid\":\"5f1e3b0c9d3b2a0001a1b2c3\"},\"total\":{\"$numberDecimal\":\"19.99\"}}\n]\n", string(out))
+
+	/// The output can be parsed again.
+	again, err := parseFixture(out)
+	assert.NoError(t, err)
+	assert.Equal(t, docs, again)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	t.Run("loads every collection", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+		assert.NoError(t, LoadFixtures(db, os.DirFS("testdata/fixtures")))
+
+		orders, err := db.Collection("orders").CountDocuments(ctx, bson.D{})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, orders)
+
+		customers, err := db.Collection("customers").CountDocuments(ctx, bson.D{})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, customers)
+	})
+	t.Run("round trips", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+		assert.NoError(t, LoadFixtures(db, os.DirFS("testdata/fixtures")))
+
+		dump, err := DumpCollection(db.Collection("orders"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(dump), `{"$oid":"5f1e3b0c9d3b2a0001a1b2c3"}`)
+		assert.Contains(t, string(dump), `{"$numberDecimal":"19.99"}`)
+		assert.Contains(t, string(dump), `{"$date":{"$numberLong":"1595816716000"}}`)
+	})
+	t.Run("missing directory", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+		assert.Error(t, LoadFixtures(db, os.DirFS("testdata/missing")))
+	})
+}
@@ -0,0 +1,159 @@
+package testmongo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bucket is a GridFS bucket with helpers to load fixtures and assert on the files it stores.
+type Bucket struct {
+	*gridfs.Bucket
+	// Name is the name of the bucket, which prefixes its `.files` and `.chunks` collections.
+	Name string
+}
+
+// NewTestBucket creates a GridFS bucket with a random name within db.
+// The bucket's collections are automatically dropped after the test finishes.
+// A name set by opts takes precedence over the random one.
+func NewTestBucket(t testing.TB, db *mongo.Database, opts ...*options.BucketOptions) (*Bucket, error) {
+	name := "fs_" + strings.ToLower(common.GenerateId())
+	for _, opt := range opts {
+		if opt != nil && opt.Name != nil {
+			name = *opt.Name
+		}
+	}
+
+	bucket, err := gridfs.NewBucket(db, append([]*options.BucketOptions{options.GridFSBucket().SetName(name)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		if err := bucket.SetWriteDeadline(time.Now().Add(common.DefaultConnTimeout)); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := bucket.Drop(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return &Bucket{Bucket: bucket, Name: name}, nil
+}
+
+// UploadFixtures uploads every file in fsys, including those in subdirectories, using its path as the filename.
+// Use os.DirFS to upload fixtures from a directory, e.g., UploadFixtures(os.DirFS("testdata/files")).
+func (b *Bucket) UploadFixtures(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		_, err = b.UploadFixture(fsys, path)
+		return err
+	})
+}
+
+// UploadFixture uploads the file with the given name in fsys using name as the filename.
+func (b *Bucket) UploadFixture(fsys fs.FS, name string) (primitive.ObjectID, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	id, err := b.UploadFromStream(name, bytes.NewReader(data))
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("uploading fixture %s: %w", name, err)
+	}
+	return id, nil
+}
+
+// ExpectFile fails t unless a file with the given name exists and returns its latest revision.
+func (b *Bucket) ExpectFile(t testing.TB, filename string) *gridfs.File {
+	t.Helper()
+
+	file, err := b.file(filename)
+	if err != nil {
+		t.Errorf("expected file %q in bucket %s: %s", filename, b.Name, err.Error())
+		return nil
+	}
+	return file
+}
+
+// ExpectNoFile fails t if a file with the given name exists.
+func (b *Bucket) ExpectNoFile(t testing.TB, filename string) {
+	t.Helper()
+
+	_, err := b.file(filename)
+	if err == nil {
+		t.Errorf("expected no file %q in bucket %s", filename, b.Name)
+	} else if !errors.Is(err, gridfs.ErrFileNotFound) {
+		t.Errorf("finding file %q in bucket %s: %s", filename, b.Name, err.Error())
+	}
+}
+
+// ExpectFileSize fails t unless the latest revision of the file with the given name is size bytes long.
+func (b *Bucket) ExpectFileSize(t testing.TB, filename string, size int64) {
+	t.Helper()
+
+	if file := b.ExpectFile(t, filename); file != nil && file.Length != size {
+		t.Errorf("expected file %q in bucket %s to be %d bytes, got %d", filename, b.Name, size, file.Length)
+	}
+}
+
+// ExpectFileChecksum fails t unless the SHA-256 checksum of the latest revision of the file with the given name,
+// as returned by Checksum, is checksum.
+func (b *Bucket) ExpectFileChecksum(t testing.TB, filename, checksum string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := b.setReadDeadline(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := b.DownloadToStreamByName(filename, &buf); err != nil {
+		t.Errorf("expected file %q in bucket %s: %s", filename, b.Name, err.Error())
+		return
+	}
+
+	if actual := Checksum(buf.Bytes()); actual != checksum {
+		t.Errorf("expected file %q in bucket %s to have checksum %s, got %s", filename, b.Name, checksum, actual)
+	}
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of data, e.g., of a fixture to compare with ExpectFileChecksum.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// file returns the latest revision of the file with the given name.
+func (b *Bucket) file(filename string) (*gridfs.File, error) {
+	if err := b.setReadDeadline(); err != nil {
+		return nil, err
+	}
+
+	stream, err := b.OpenDownloadStreamByName(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return stream.GetFile(), nil
+}
+
+func (b *Bucket) setReadDeadline() error {
+	return b.SetReadDeadline(time.Now().Add(common.DefaultConnTimeout))
+}
@@ -0,0 +1,71 @@
+package testmongo
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestChecksum(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Checksum(nil))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", Checksum([]byte("hello")))
+}
+
+func TestNewTestBucket(t *testing.T) {
+	t.Parallel()
+	con, err := RunTest(t)
+	assert.NoError(t, err)
+
+	fixtures := os.DirFS("testdata/gridfs")
+	hello, err := os.ReadFile("testdata/gridfs/hello.txt")
+	assert.NoError(t, err)
+
+	t.Run("uploads fixtures", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		bucket, err := NewTestBucket(t, db)
+		assert.NoError(t, err)
+		assert.NoError(t, bucket.UploadFixtures(fixtures))
+
+		bucket.ExpectFile(t, "images/logo.png")
+		bucket.ExpectFileSize(t, "hello.txt", int64(len(hello)))
+		bucket.ExpectFileChecksum(t, "hello.txt", Checksum(hello))
+		bucket.ExpectNoFile(t, "missing.txt")
+	})
+	t.Run("uses name from options", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		bucket, err := NewTestBucket(t, db, options.GridFSBucket().SetName("attachments"))
+		assert.NoError(t, err)
+		assert.Equal(t, "attachments", bucket.Name)
+
+		_, err = bucket.UploadFixture(fixtures, "hello.txt")
+		assert.NoError(t, err)
+		bucket.ExpectFile(t, "hello.txt")
+	})
+	t.Run("fails on mismatch", func(t *testing.T) {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		bucket, err := NewTestBucket(t, db)
+		assert.NoError(t, err)
+		_, err = bucket.UploadFixture(fixtures, "hello.txt")
+		assert.NoError(t, err)
+
+		rec := &testutil.RecordingTB{TB: t}
+		bucket.ExpectFileSize(rec, "hello.txt", 1)
+		bucket.ExpectFileChecksum(rec, "hello.txt", Checksum(nil))
+		bucket.ExpectNoFile(rec, "hello.txt")
+		assert.Equal(t, []string{
+			fmt.Sprintf(`expected file "hello.txt" in bucket %s to be 1 bytes, got 13`, bucket.Name),
+			fmt.Sprintf(`expected file "hello.txt" in bucket %s to have checksum %s, got %s`, bucket.Name, Checksum(nil), Checksum([]byte("hello gridfs\n"))),
+			fmt.Sprintf(`expected no file "hello.txt" in bucket %s`, bucket.Name),
+		}, rec.Messages())
+	})
+}
@@ -0,0 +1,66 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	internalmatrix "github.com/kyleishie/testdeps/pkg/internal/matrix"
+	"github.com/kyleishie/testdeps/pkg/options"
+)
+
+// Matrix runs tests against several tags of the `mongo` image.
+// One Container is started per tag the first time it is needed and is shared by every test using the Matrix.
+// Declare the Matrix as a package level variable to share the containers across the whole package.
+// Call Terminate from TestMain once the tests have run to remove the containers.
+type Matrix struct {
+	matrix *internalmatrix.Matrix
+}
+
+// NewMatrix creates a Matrix for the given image tags, e.g., "5", "6", "7".
+// The options are applied to every Container, followed by options.WithCustomTag for its tag.
+func NewMatrix(tags []string, opts ...options.Option) *Matrix {
+	return &Matrix{
+		matrix: internalmatrix.New(tags, func(ctx context.Context, tag string) (internalmatrix.Container, error) {
+			con, err := RunWithContext(ctx, append(append([]options.Option{}, opts...), options.WithCustomTag(tag))...)
+			if err != nil {
+				return nil, err
+			}
+			return con, nil
+		}),
+	}
+}
+
+// Run calls fn once per tag in a subtest named after the tag.
+// A default context is used with a timeout of two minutes to start each Container. To customize use RunWithContext.
+func (m *Matrix) Run(t *testing.T, fn func(t *testing.T, con *Container)) {
+	m.matrix.Run(t, func(t *testing.T, tag string) {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		fn(t, m.matrix.ContainerForTest(t, ctx, tag).(*Container))
+	})
+}
+
+// RunWithContext calls fn once per tag in a subtest named after the tag.
+// A context can be provided to configure things such as the timeout for starting each Container.
+func (m *Matrix) RunWithContext(t *testing.T, ctx context.Context, fn func(t *testing.T, con *Container)) {
+	m.matrix.Run(t, func(t *testing.T, tag string) {
+		fn(t, m.matrix.ContainerForTest(t, ctx, tag).(*Container))
+	})
+}
+
+// Container returns the shared Container for tag, starting it if necessary.
+// A failed start is retried by the next call.
+func (m *Matrix) Container(ctx context.Context, tag string) (*Container, error) {
+	con, err := m.matrix.Container(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return con.(*Container), nil
+}
+
+// Terminate terminates every Container started by the Matrix, e.g., from TestMain after the tests have run.
+// Containers are started again if the Matrix is used afterwards.
+func (m *Matrix) Terminate(ctx context.Context) error {
+	return m.matrix.Terminate(ctx)
+}
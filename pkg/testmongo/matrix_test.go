@@ -0,0 +1,55 @@
+package testmongo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var matrix = NewMatrix([]string{"5", "6"})
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if err := matrix.Terminate(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func TestMatrix_Run(t *testing.T) {
+	t.Run("runs every tag", func(t *testing.T) {
+		var versions []string
+		matrix.Run(t, func(t *testing.T, con *Container) {
+			client, err := con.NewTestClient(t)
+			assert.NoError(t, err)
+
+			var info bson.M
+			assert.NoError(t, client.Database("admin").RunCommand(context.Background(), bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info))
+			versions = append(versions, info["version"].(string))
+		})
+		assert.Len(t, versions, 2)
+	})
+	t.Run("shares containers", func(t *testing.T) {
+		first, err := matrix.Container(context.Background(), "5")
+		assert.NoError(t, err)
+		second, err := matrix.Container(context.Background(), "5")
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+	t.Run("terminates containers", func(t *testing.T) {
+		local := NewMatrix([]string{"5"})
+		first, err := local.Container(context.Background(), "5")
+		assert.NoError(t, err)
+		assert.NoError(t, local.Terminate(context.Background()))
+
+		second, err := local.Container(context.Background(), "5")
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+		assert.NoError(t, local.Terminate(context.Background()))
+	})
+}
@@ -0,0 +1,81 @@
+package testmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/mongodb"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migrate returns a DatabaseSetup that applies every up migration in fsys.
+// Migrations are golang-migrate MongoDB migrations, i.e., `<version>_<title>.up.json` files at the root of fsys
+// that contain an array of database commands.
+// Use os.DirFS to read migrations from a directory, e.g., Migrate(os.DirFS("testdata/migrations")).
+func Migrate(fsys fs.FS) DatabaseSetup {
+	return func(ctx context.Context, db *mongo.Database) error {
+		return runMigrations(ctx, db, fsys, func(m *migrate.Migrate) error {
+			return m.Up()
+		})
+	}
+}
+
+// MigrateToVersion is the same as Migrate except the migrations are only applied up to and including version.
+// This allows testing code against an older schema, e.g., for backwards compatibility.
+func MigrateToVersion(fsys fs.FS, version uint) DatabaseSetup {
+	return func(ctx context.Context, db *mongo.Database) error {
+		return runMigrations(ctx, db, fsys, func(m *migrate.Migrate) error {
+			return m.Migrate(version)
+		})
+	}
+}
+
+// WithMigrations returns a copy of the Container that applies every up migration in fsys to every database it creates.
+// To migrate to a specific version use WithDatabaseSetup(MigrateToVersion(fsys, version)).
+func (c *Container) WithMigrations(fsys fs.FS) *Container {
+	return c.WithDatabaseSetup(Migrate(fsys))
+}
+
+// WithMigrationsDir is the same as WithMigrations except the migrations are read from the directory at the given path.
+func (c *Container) WithMigrationsDir(dir string) *Container {
+	return c.WithMigrations(os.DirFS(dir))
+}
+
+func runMigrations(ctx context.Context, db *mongo.Database, fsys fs.FS, run func(m *migrate.Migrate) error) error {
+	source, err := iofs.New(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+	/// The database driver is not closed since that would disconnect the client of db.
+	defer source.Close()
+
+	driver, err := mongodb.WithInstance(db.Client(), &mongodb.Config{DatabaseName: db.Name()})
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "mongodb", driver)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	if err := run(m); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migrating database %s: %w", db.Name(), err)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,56 @@
+package testmongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	indexNames := func(t *testing.T, ctx context.Context, con *Container) []string {
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		specs, err := db.Collection("users").Indexes().ListSpecifications(ctx)
+		assert.NoError(t, err)
+
+		var names []string
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		return names
+	}
+
+	t.Run("applies every migration", func(t *testing.T) {
+		ctx := context.Background()
+		names := indexNames(t, ctx, con.WithMigrationsDir("testdata/migrations"))
+		assert.Contains(t, names, "email_1")
+	})
+	t.Run("migrates to a version", func(t *testing.T) {
+		ctx := context.Background()
+		names := indexNames(t, ctx, con.WithDatabaseSetup(MigrateToVersion(os.DirFS("testdata/migrations"), 1)))
+		assert.Equal(t, []string{"_id_"}, names)
+	})
+	t.Run("migrated schema is enforced", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.WithMigrations(os.DirFS("testdata/migrations")).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		users := db.Collection("users")
+		_, err = users.InsertOne(ctx, bson.D{{Key: "email", Value: "a@example.com"}})
+		assert.NoError(t, err)
+		_, err = users.InsertOne(ctx, bson.D{{Key: "email", Value: "a@example.com"}})
+		assert.Error(t, err)
+	})
+	t.Run("forwards errors", func(t *testing.T) {
+		db, err := con.WithMigrationsDir("testdata/missing").NewDatabase("migrations_missing")
+		assert.Nil(t, db)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,261 @@
+package testmongo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collScanStage = "COLLSCAN"
+
+// explainableCommands are the commands whose query plan can be inspected with explain.
+var explainableCommands = map[string]bool{
+	"find":          true,
+	"aggregate":     true,
+	"count":         true,
+	"distinct":      true,
+	"update":        true,
+	"delete":        true,
+	"findAndModify": true,
+}
+
+// Command is a single command recorded by a CommandRecorder.
+type Command struct {
+	Name       string
+	Database   string
+	Collection string
+	// Filter is the query filter of the command, if it has one.
+	Filter   bson.Raw
+	Command  bson.Raw
+	Duration time.Duration
+	Failed   bool
+}
+
+// CommandRecorder records every command sent by the clients it is attached to.
+// Attach it with Container.WithClientOptions, e.g., con.WithClientOptions(recorder.ClientOptions()).NewTestDatabase(t).
+type CommandRecorder struct {
+	mu       sync.Mutex
+	started  map[int64]Command
+	commands []Command
+}
+
+// NewCommandRecorder creates an empty CommandRecorder.
+func NewCommandRecorder() *CommandRecorder {
+	return &CommandRecorder{
+		started: make(map[int64]Command),
+	}
+}
+
+// Monitor returns an event.CommandMonitor that records commands in the CommandRecorder.
+func (r *CommandRecorder) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			cmd := append(bson.Raw(nil), e.Command...)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.started[e.RequestID] = Command{
+				Name:       e.CommandName,
+				Database:   e.DatabaseName,
+				Collection: commandCollection(cmd),
+				Filter:     commandFilter(e.CommandName, cmd),
+				Command:    cmd,
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			r.finish(e.CommandFinishedEvent, false)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			r.finish(e.CommandFinishedEvent, true)
+		},
+	}
+}
+
+// ClientOptions returns client options that attach the CommandRecorder's Monitor.
+func (r *CommandRecorder) ClientOptions() *options.ClientOptions {
+	return options.Client().SetMonitor(r.Monitor())
+}
+
+// Commands returns every command that finished since the CommandRecorder was created or Reset.
+func (r *CommandRecorder) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Command(nil), r.commands...)
+}
+
+// Reset forgets every recorded command, e.g., after a test has finished seeding data.
+func (r *CommandRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+// ExpectCommand fails t unless a command with the given name, e.g., "find", was recorded.
+// If collection is not empty the command must also target that collection.
+// The first matching command is returned.
+func (r *CommandRecorder) ExpectCommand(t testing.TB, name, collection string) Command {
+	t.Helper()
+
+	for _, cmd := range r.Commands() {
+		if cmd.Name == name && (collection == "" || cmd.Collection == collection) {
+			return cmd
+		}
+	}
+
+	t.Errorf("expected command %q on collection %q to be issued, recorded %s", name, collection, r.summary())
+	return Command{}
+}
+
+// ExpectMaxRoundTrips fails t if more than max commands were recorded.
+func (r *CommandRecorder) ExpectMaxRoundTrips(t testing.TB, max int) {
+	t.Helper()
+
+	if commands := r.Commands(); len(commands) > max {
+		t.Errorf("expected at most %d round trips, recorded %d: %s", max, len(commands), r.summary())
+	}
+}
+
+// ExpectNoCollectionScan explains every recorded query using client and fails t if any of them would scan a whole collection.
+// client should not be attached to the CommandRecorder, otherwise the explain commands are recorded too.
+func (r *CommandRecorder) ExpectNoCollectionScan(t testing.TB, ctx context.Context, client *mongo.Client) {
+	t.Helper()
+
+	for _, cmd := range r.Commands() {
+		if !explainableCommands[cmd.Name] || cmd.Failed {
+			continue
+		}
+
+		plan, err := explain(ctx, client, cmd)
+		if err != nil {
+			t.Errorf("explaining %s on %s: %s", cmd.Name, cmd.Collection, err.Error())
+			continue
+		}
+		if hasStage(plan, collScanStage) {
+			t.Errorf("%s on collection %q with filter %s performs a %s", cmd.Name, cmd.Collection, cmd.Filter, collScanStage)
+		}
+	}
+}
+
+func (r *CommandRecorder) finish(e event.CommandFinishedEvent, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd, exists := r.started[e.RequestID]
+	if !exists {
+		return
+	}
+	delete(r.started, e.RequestID)
+
+	cmd.Duration = time.Duration(e.DurationNanos)
+	cmd.Failed = failed
+	r.commands = append(r.commands, cmd)
+}
+
+func (r *CommandRecorder) summary() string {
+	var names []string
+	for _, cmd := range r.Commands() {
+		names = append(names, cmd.Name+"("+cmd.Collection+")")
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// commandCollection returns the collection a command targets, which is the value of its first element.
+func commandCollection(cmd bson.Raw) string {
+	elems, err := cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+	collection, _ := elems[0].Value().StringValueOK()
+	return collection
+}
+
+// commandFilter returns the query filter of a command, if it has one.
+func commandFilter(name string, cmd bson.Raw) bson.Raw {
+	var path []string
+	switch name {
+	case "find":
+		path = []string{"filter"}
+	case "count", "distinct", "findAndModify":
+		path = []string{"query"}
+	case "update":
+		path = []string{"updates", "0", "q"}
+	case "delete":
+		path = []string{"deletes", "0", "q"}
+	case "aggregate":
+		path = []string{"pipeline", "0", "$match"}
+	default:
+		return nil
+	}
+
+	value, err := cmd.LookupErr(path...)
+	if err != nil {
+		return nil
+	}
+	filter, _ := value.DocumentOK()
+	return filter
+}
+
+// explain runs the explain command for cmd and returns its query planner output.
+func explain(ctx context.Context, client *mongo.Client, cmd Command) (bson.Raw, error) {
+	elems, err := cmd.Command.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	/// Strip the fields the driver adds to every command, explain rejects them on the inner command.
+	explained := bson.D{}
+	for _, elem := range elems {
+		key := elem.Key()
+		if strings.HasPrefix(key, "$") || key == "lsid" || key == "txnNumber" || key == "writeConcern" {
+			continue
+		}
+		explained = append(explained, bson.E{Key: key, Value: elem.Value()})
+	}
+
+	result, err := client.Database(cmd.Database).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: explained},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	/// Aggregations report their plan per stage rather than at the top level.
+	if planner, err := result.LookupErr("queryPlanner"); err == nil {
+		return planner.Document(), nil
+	}
+	return result, nil
+}
+
+// hasStage reports whether stage is part of any winning plan in doc. Rejected plans are ignored.
+func hasStage(doc bson.Raw, stage string) bool {
+	elems, err := doc.Elements()
+	if err != nil {
+		return false
+	}
+
+	for _, elem := range elems {
+		if elem.Key() == "rejectedPlans" {
+			continue
+		}
+		value := elem.Value()
+		if elem.Key() == "stage" {
+			if s, ok := value.StringValueOK(); ok && s == stage {
+				return true
+			}
+		}
+		if nested, ok := value.DocumentOK(); ok && hasStage(nested, stage) {
+			return true
+		}
+		if nested, ok := value.ArrayOK(); ok && hasStage(bson.Raw(nested), stage) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mustMarshal(t *testing.T, doc interface{}) bson.Raw {
+	raw, err := bson.Marshal(doc)
+	assert.NoError(t, err)
+	return raw
+}
+
+func TestCommandCollection(t *testing.T) {
+	assert.Equal(t, "orders", commandCollection(mustMarshal(t, bson.D{{Key: "find", Value: "orders"}})))
+	assert.Empty(t, commandCollection(mustMarshal(t, bson.D{{Key: "ping", Value: 1}})))
+}
+
+func TestCommandFilter(t *testing.T) {
+	t.Run("find", func(t *testing.T) {
+		cmd := mustMarshal(t, bson.D{{Key: "find", Value: "orders"}, {Key: "filter", Value: bson.D{{Key: "status", Value: "paid"}}}})
+		assert.Equal(t, mustMarshal(t, bson.D{{Key: "status", Value: "paid"}}), commandFilter("find", cmd))
+	})
+	t.Run("update", func(t *testing.T) {
+		cmd := mustMarshal(t, bson.D{{Key: "update", Value: "orders"}, {Key: "updates", Value: bson.A{
+			bson.D{{Key: "q", Value: bson.D{{Key: "status", Value: "paid"}}}},
+		}}})
+		assert.Equal(t, mustMarshal(t, bson.D{{Key: "status", Value: "paid"}}), commandFilter("update", cmd))
+	})
+	t.Run("insert", func(t *testing.T) {
+		cmd := mustMarshal(t, bson.D{{Key: "insert", Value: "orders"}})
+		assert.Nil(t, commandFilter("insert", cmd))
+	})
+}
+
+func TestHasStage(t *testing.T) {
+	t.Run("winning plan", func(t *testing.T) {
+		plan := mustMarshal(t, bson.D{{Key: "winningPlan", Value: bson.D{
+			{Key: "stage", Value: "FETCH"},
+			{Key: "inputStage", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}},
+		}}})
+		assert.True(t, hasStage(plan, "COLLSCAN"))
+	})
+	t.Run("rejected plan", func(t *testing.T) {
+		plan := mustMarshal(t, bson.D{
+			{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "IXSCAN"}}},
+			{Key: "rejectedPlans", Value: bson.A{bson.D{{Key: "stage", Value: "COLLSCAN"}}}},
+		})
+		assert.False(t, hasStage(plan, "COLLSCAN"))
+	})
+	t.Run("sharded", func(t *testing.T) {
+		plan := mustMarshal(t, bson.D{{Key: "winningPlan", Value: bson.D{{Key: "shards", Value: bson.A{
+			bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}}},
+		}}}}})
+		assert.True(t, hasStage(plan, "COLLSCAN"))
+	})
+}
+
+func TestCommandRecorder(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	t.Run("records commands", func(t *testing.T) {
+		ctx := context.Background()
+		recorder := NewCommandRecorder()
+		db, err := con.WithClientOptions(recorder.ClientOptions()).NewTestDatabase(t)
+		assert.NoError(t, err)
+		recorder.Reset()
+
+		_, err = db.Collection("orders").InsertOne(ctx, bson.D{{Key: "status", Value: "paid"}})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Collection("orders").FindOne(ctx, bson.D{{Key: "status", Value: "paid"}}).Err())
+
+		find := recorder.ExpectCommand(t, "find", "orders")
+		assert.Equal(t, mustMarshal(t, bson.D{{Key: "status", Value: "paid"}}), find.Filter)
+		recorder.ExpectMaxRoundTrips(t, 2)
+	})
+	t.Run("detects collection scans", func(t *testing.T) {
+		ctx := context.Background()
+		recorder := NewCommandRecorder()
+		db, err := con.WithClientOptions(recorder.ClientOptions()).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		_, err = db.Collection("orders").InsertOne(ctx, bson.D{{Key: "status", Value: "paid"}})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Collection("orders").FindOne(ctx, bson.D{{Key: "status", Value: "paid"}}).Err())
+
+		client, err := con.NewTestClient(t)
+		assert.NoError(t, err)
+
+		rec := &testutil.RecordingTB{TB: t}
+		recorder.ExpectNoCollectionScan(rec, ctx, client)
+		if assert.Len(t, rec.Messages(), 1) {
+			assert.Contains(t, rec.Messages()[0], `find on collection "orders"`)
+			assert.Contains(t, rec.Messages()[0], "performs a COLLSCAN")
+		}
+	})
+}
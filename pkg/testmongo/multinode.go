@@ -0,0 +1,442 @@
+package testmongo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongooptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	memberAliasPrefix   = "mongo"
+	memberPort          = 27017
+	stepDownSeconds     = 60
+	keyFileContentBytes = 48
+)
+
+// ReplicaSet is a replica set whose members each run in their own docker Container on a shared docker network.
+type ReplicaSet struct {
+	// Name is the name of the replica set.
+	Name string
+	// Members are the running members of the replica set.
+	// The ConnectionString of each member connects directly to that member.
+	Members []*Container
+	// ConnectionString lists every member by its hostname on the docker network.
+	// These hostnames only resolve within the network, so connect from the host using ClientOptions or NewClient.
+	ConnectionString string
+
+	network tc.Network
+	dialer  *memberDialer
+
+	mu          sync.Mutex
+	memberHosts map[*Container]string
+}
+
+// RunReplicaSet creates and starts a replica set with the given number of members using the `mongo` image.
+// Three members are required to test elections. Every member receives the same options. WithTLS is not supported.
+// A default context is used with a timeout of two minutes. To customize use RunReplicaSetWithContext.
+func RunReplicaSet(members int, opts ...options.Option) (*ReplicaSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunReplicaSetWithContext(ctx, members, opts...)
+}
+
+// RunReplicaSetWithContext creates and starts a replica set with the given number of members using the `mongo` image.
+// Three members are required to test elections. Every member receives the same options. WithTLS is not supported.
+// A context can be provided to configure things such as timeout.
+func RunReplicaSetWithContext(ctx context.Context, members int, opts ...options.Option) (rs *ReplicaSet, err error) {
+	if members < 1 {
+		return nil, fmt.Errorf("a replica set requires at least one member, got %d", members)
+	}
+
+	probe, err := makeContainerRequest(opts)
+	if err != nil {
+		return
+	}
+	if tlsEnabled(probe) {
+		return nil, errors.New("replica sets do not support WithTLS")
+	}
+
+	network, networkName, err := newNetwork(ctx)
+	if err != nil {
+		return
+	}
+
+	rs, err = startReplicaSet(ctx, networkName, memberAliasPrefix, members, false, opts)
+	if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		_ = network.Remove(ctx)
+		return nil, err
+	}
+	rs.network = network
+
+	return
+}
+
+// startReplicaSet starts and initiates a replica set on an existing docker network.
+// Members are reachable within the network as aliasPrefix followed by their index.
+// Config server replica sets must be initiated with configsvr set.
+func startReplicaSet(ctx context.Context, networkName, aliasPrefix string, members int, configsvr bool, opts []options.Option) (rs *ReplicaSet, err error) {
+	rs = &ReplicaSet{
+		dialer:      &memberDialer{addrs: make(map[string]string)},
+		memberHosts: make(map[*Container]string),
+	}
+	defer func() {
+		if err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+			defer cancel()
+			_ = rs.Terminate(ctx)
+			rs = nil
+		}
+	}()
+
+	keyFile, err := generateKeyFile()
+	if err != nil {
+		return
+	}
+
+	var hosts []string
+	var rootUserPrefix string
+	for i := 0; i < members; i++ {
+		cReq, err := makeContainerRequest(opts)
+		if err != nil {
+			return rs, err
+		}
+
+		if _, exists := replicaSetName(cReq); !exists {
+			if err := WithReplicaSet()(&cReq); err != nil {
+				return rs, err
+			}
+		}
+		rs.Name, _ = replicaSetName(cReq)
+
+		/// Only the first member initializes the root user. The others receive it when they sync.
+		if i == 0 {
+			rootUserPrefix = makeRootUserPrefix(cReq)
+		} else {
+			delete(cReq.Env, env_MONGO_INITDB_ROOT_USERNAME)
+			delete(cReq.Env, env_MONGO_INITDB_ROOT_PASSWORD)
+		}
+		if rootUserPrefix != "" {
+			cReq.Env[env_TESTDEPS_MONGO_KEYFILE] = keyFile
+		}
+
+		alias := fmt.Sprintf("%s%d", aliasPrefix, i)
+		host := fmt.Sprintf("%s:%d", alias, memberPort)
+		cReq.Networks = []string{networkName}
+		cReq.NetworkAliases = map[string][]string{networkName: {alias}}
+
+		if err := rs.startMember(ctx, cReq, host, rootUserPrefix); err != nil {
+			return rs, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	rs.ConnectionString = fmt.Sprintf("%s://%s%s/?replicaSet=%s", proto, rootUserPrefix, strings.Join(hosts, ","), rs.Name)
+
+	client, err := mongo.Connect(ctx, mongooptions.Client().ApplyURI(rs.Members[0].ConnectionString))
+	if err != nil {
+		return
+	}
+	defer client.Disconnect(ctx)
+
+	if err = replSetInitiate(ctx, client.Database("admin"), rs.Name, configsvr, hosts...); err != nil {
+		return
+	}
+
+	_, err = rs.WaitForPrimary(ctx)
+	return
+}
+
+// RunReplicaSetTest creates and starts a replica set with the given number of members using the `mongo` image.
+// Every member and the network are automatically removed after the test is finished.
+// A default context is used with a timeout of two minutes. To customize use RunReplicaSetTestWithContext.
+func RunReplicaSetTest(t *testing.T, members int, opts ...options.Option) (*ReplicaSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunReplicaSetTestWithContext(t, ctx, members, opts...)
+}
+
+// RunReplicaSetTestWithContext creates and starts a replica set with the given number of members using the `mongo` image.
+// A context can be provided to configure things such as timeout.
+// Every member and the network are automatically removed after the test is finished.
+func RunReplicaSetTestWithContext(t *testing.T, ctx context.Context, members int, opts ...options.Option) (*ReplicaSet, error) {
+	rs, err := RunReplicaSetWithContext(ctx, members, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if err := rs.Terminate(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return rs, nil
+}
+
+// ClientOptions returns client options for ConnectionString with a dialer that routes each member's
+// network hostname to its mapped port on the host. Use it to build clients with additional options.
+func (rs *ReplicaSet) ClientOptions() *mongooptions.ClientOptions {
+	return mongooptions.Client().ApplyURI(rs.ConnectionString).SetDialer(rs.dialer)
+}
+
+// NewClient creates a mongo client connected to the whole replica set.
+// The connection is tested once before returning the new client.
+func (rs *ReplicaSet) NewClient() (*mongo.Client, error) {
+	return rs.NewClientWithContext(context.Background())
+}
+
+// NewClientWithContext creates a mongo client connected to the whole replica set.
+// The connection is tested once before returning the new client.
+func (rs *ReplicaSet) NewClientWithContext(ctx context.Context) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, rs.ClientOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// NewTestClient creates a mongo client connected to the whole replica set.
+// The client is disconnected automatically after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func (rs *ReplicaSet) NewTestClient(t *testing.T) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return rs.NewTestClientWithContext(t, ctx)
+}
+
+// NewTestClientWithContext creates a mongo client connected to the whole replica set.
+// The client is disconnected automatically after the test finishes.
+func (rs *ReplicaSet) NewTestClientWithContext(t *testing.T, ctx context.Context) (*mongo.Client, error) {
+	client, err := rs.NewClientWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return client, nil
+}
+
+// Primary returns the member that is currently PRIMARY.
+// If no member is PRIMARY, e.g., during an election, Primary blocks until one is elected or ctx is done.
+func (rs *ReplicaSet) Primary(ctx context.Context) (*Container, error) {
+	client, err := mongo.Connect(ctx, rs.ClientOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(ctx)
+
+	var result struct {
+		Me string `bson:"me"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for member, host := range rs.memberHosts {
+		if host == result.Me {
+			return member, nil
+		}
+	}
+	return nil, fmt.Errorf("primary %s is not a member of the replica set", result.Me)
+}
+
+// WaitForPrimary blocks until a member is PRIMARY and returns it.
+func (rs *ReplicaSet) WaitForPrimary(ctx context.Context) (*Container, error) {
+	return rs.waitForPrimaryOtherThan(ctx, nil)
+}
+
+// StepDown asks the current PRIMARY to step down and waits for another member to be elected.
+// The former PRIMARY is not eligible for re-election for sixty seconds.
+func (rs *ReplicaSet) StepDown(ctx context.Context) (*Container, error) {
+	primary, err := rs.Primary(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := primary.NewClientWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(ctx)
+
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetStepDown", Value: stepDownSeconds}}).Err()
+	/// Older servers close every connection when stepping down so the reply may be lost.
+	if err != nil && !mongo.IsNetworkError(err) {
+		return nil, err
+	}
+
+	return rs.waitForPrimaryOtherThan(ctx, primary)
+}
+
+// StopPrimary terminates the Container of the current PRIMARY and waits for another member to be elected.
+// The terminated member is removed from Members.
+func (rs *ReplicaSet) StopPrimary(ctx context.Context) (*Container, error) {
+	primary, err := rs.Primary(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := primary.Terminate(ctx); err != nil {
+		return nil, err
+	}
+	rs.removeMember(primary)
+
+	return rs.waitForPrimaryOtherThan(ctx, primary)
+}
+
+// Terminate terminates every member of the ReplicaSet and removes its network.
+// Every member is terminated even if another fails to, the first error is returned.
+func (rs *ReplicaSet) Terminate(ctx context.Context) error {
+	var firstErr error
+	for i, member := range rs.Members {
+		if err := member.Terminate(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error terminating member %d: %w", i, err)
+		}
+	}
+
+	if rs.network != nil {
+		if err := rs.network.Remove(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error removing network: %w", err)
+		}
+	}
+
+	return firstErr
+}
+
+func (rs *ReplicaSet) startMember(ctx context.Context, cReq tc.ContainerRequest, host, rootUserPrefix string) error {
+	member, err := startContainer(ctx, cReq)
+	if err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.Members = append(rs.Members, member)
+	rs.memberHosts[member] = host
+
+	mappedHost, err := member.Host(ctx)
+	if err != nil {
+		return err
+	}
+	port, err := member.MappedPort(ctx, mappedPort)
+	if err != nil {
+		return err
+	}
+
+	member.ConnectionString = fmt.Sprintf("%s://%s%s:%d/?directConnection=true", proto, rootUserPrefix, mappedHost, port.Int())
+	rs.dialer.set(host, fmt.Sprintf("%s:%d", mappedHost, port.Int()))
+
+	return nil
+}
+
+func (rs *ReplicaSet) removeMember(member *Container) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	delete(rs.memberHosts, member)
+	for i, m := range rs.Members {
+		if m == member {
+			rs.Members = append(rs.Members[:i], rs.Members[i+1:]...)
+			return
+		}
+	}
+}
+
+func (rs *ReplicaSet) waitForPrimaryOtherThan(ctx context.Context, previous *Container) (*Container, error) {
+	ticker := time.NewTicker(primaryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		primary, err := rs.Primary(ctx)
+		if err == nil && primary != previous {
+			return primary, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = errors.New("no new primary was elected")
+			}
+			return nil, fmt.Errorf("waiting for primary: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// memberDialer routes the hostnames members use on the docker network to their mapped ports on the host.
+type memberDialer struct {
+	net.Dialer
+
+	mu    sync.RWMutex
+	addrs map[string]string
+}
+
+func (d *memberDialer) set(address, mapped string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addrs[address] = mapped
+}
+
+// DialContext implements options.ContextDialer.
+func (d *memberDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.RLock()
+	if mapped, exists := d.addrs[address]; exists {
+		address = mapped
+	}
+	d.mu.RUnlock()
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+// newNetwork creates a docker network with a random name.
+func newNetwork(ctx context.Context) (tc.Network, string, error) {
+	name := "testdeps-" + common.GenerateId()
+	network, err := tc.GenericNetwork(ctx, tc.GenericNetworkRequest{
+		NetworkRequest: tc.NetworkRequest{
+			Name:           name,
+			CheckDuplicate: true,
+		},
+	})
+	return network, name, err
+}
+
+// generateKeyFile returns random key file content that members of a replica set can share.
+func generateKeyFile() (string, error) {
+	key := make([]byte, keyFileContentBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
@@ -0,0 +1,77 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRunReplicaSet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rejects empty replica set", func(t *testing.T) {
+		t.Parallel()
+		rs, err := RunReplicaSet(0)
+		assert.Error(t, err)
+		assert.Nil(t, rs)
+	})
+	t.Run("rejects TLS", func(t *testing.T) {
+		t.Parallel()
+		rs, err := RunReplicaSet(1, WithTLS())
+		assert.EqualError(t, err, "replica sets do not support WithTLS")
+		assert.Nil(t, rs)
+	})
+	t.Run("should start members", func(t *testing.T) {
+		t.Parallel()
+		rs, err := RunReplicaSetTest(t, 3)
+		assert.NoError(t, err)
+		assert.Len(t, rs.Members, 3)
+		assert.Contains(t, rs.ConnectionString, "replicaSet=rs0")
+
+		client, err := rs.NewTestClient(t)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Ping(context.Background(), nil))
+	})
+}
+
+func TestReplicaSet_Failover(t *testing.T) {
+	t.Parallel()
+
+	t.Run("step down", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		rs, err := RunReplicaSetTest(t, 3)
+		assert.NoError(t, err)
+
+		previous, err := rs.Primary(ctx)
+		assert.NoError(t, err)
+
+		primary, err := rs.StepDown(ctx)
+		assert.NoError(t, err)
+		assert.NotSame(t, previous, primary)
+	})
+	t.Run("stop primary", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		rs, err := RunReplicaSetTest(t, 3)
+		assert.NoError(t, err)
+
+		client, err := rs.NewTestClient(t)
+		assert.NoError(t, err)
+		collection := client.Database("test").Collection("orders")
+
+		previous, err := rs.Primary(ctx)
+		assert.NoError(t, err)
+
+		primary, err := rs.StopPrimary(ctx)
+		assert.NoError(t, err)
+		assert.NotSame(t, previous, primary)
+		assert.Len(t, rs.Members, 2)
+
+		/// Retryable writes survive the election.
+		_, err = collection.InsertOne(ctx, bson.D{{Key: "status", Value: "paid"}})
+		assert.NoError(t, err)
+	})
+}
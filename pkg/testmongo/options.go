@@ -8,6 +8,10 @@ import (
 const (
 	env_MONGO_INITDB_ROOT_USERNAME = "MONGO_INITDB_ROOT_USERNAME"
 	env_MONGO_INITDB_ROOT_PASSWORD = "MONGO_INITDB_ROOT_PASSWORD"
+	env_TESTDEPS_MONGO_KEYFILE     = "TESTDEPS_MONGO_KEYFILE"
+	env_TESTDEPS_MONGO_TLS         = "TESTDEPS_MONGO_TLS"
+	env_TESTDEPS_MONGO_TLS_CA      = "TESTDEPS_MONGO_TLS_CA"
+	env_TESTDEPS_MONGO_TLS_CERT    = "TESTDEPS_MONGO_TLS_CERT"
 )
 
 // WithRootUser sets MONGO_INITDB_ROOT_USERNAME & MONGO_INITDB_ROOT_PASSWORD to the given username & password.
@@ -17,3 +17,28 @@ func TestWithRootUser(t *testing.T) {
 	assert.Equal(t, testUser, cReq.Env["MONGO_INITDB_ROOT_USERNAME"])
 	assert.Equal(t, testPass, cReq.Env["MONGO_INITDB_ROOT_PASSWORD"])
 }
+
+func TestWithReplicaSet(t *testing.T) {
+	fn := WithReplicaSet()
+	cReq := tc.ContainerRequest{}
+	err := fn(&cReq)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--replSet", "rs0"}, cReq.Cmd)
+	assert.NotEmpty(t, cReq.Entrypoint)
+}
+
+func TestWithReplicaSetName(t *testing.T) {
+	t.Run("custom name", func(t *testing.T) {
+		fn := WithReplicaSetName("test")
+		cReq := tc.ContainerRequest{}
+		err := fn(&cReq)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"--replSet", "test"}, cReq.Cmd)
+	})
+	t.Run("empty name", func(t *testing.T) {
+		fn := WithReplicaSetName("")
+		cReq := tc.ContainerRequest{}
+		err := fn(&cReq)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,139 @@
+package testmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongooptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	argReplSet                = "--replSet"
+	defaultReplicaSetName     = "rs0"
+	keyFilePath               = "/etc/mongo-keyfile"
+	primaryPollInterval       = time.Millisecond * 100
+	errCodeAlreadyInitialized = 23
+
+	// keyFileScript writes a key file when a replica set is configured along with a root user or shared key,
+	// since mongod requires one to enable both authorization and replication.
+	// The key is taken from TESTDEPS_MONGO_KEYFILE so members of a set can share it, otherwise it is random.
+	keyFileScript = `if { [ -n "$` + env_MONGO_INITDB_ROOT_USERNAME + `" ] || [ -n "$` + env_TESTDEPS_MONGO_KEYFILE + `" ]; } && printf '%s\n' "$@" | grep -qx -- ` + argReplSet + `; then ` +
+		`printf '%s' "${` + env_TESTDEPS_MONGO_KEYFILE + `:-$(head -c 756 /dev/urandom | base64)}" > ` + keyFilePath + ` && chmod 400 ` + keyFilePath + ` && chown mongodb:mongodb ` + keyFilePath + ` && ` +
+		`set -- "$@" --keyFile ` + keyFilePath + `; fi && `
+)
+
+// WithReplicaSet starts mongod as the only member of a replica set named `rs0`.
+// The replica set is initiated before the Container is returned and its connection string includes
+// `replicaSet` and `directConnection` so that transactions and change streams can be used.
+func WithReplicaSet() options.Option {
+	return WithReplicaSetName(defaultReplicaSetName)
+}
+
+// WithReplicaSetName is the same as WithReplicaSet except the replica set is given the name provided.
+func WithReplicaSetName(name string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if name == "" {
+			return errors.New("replica set name must not be empty")
+		}
+		request.Entrypoint = []string{"bash", "-c", entrypoint, "--"}
+		request.Cmd = append(request.Cmd, argReplSet, name)
+		return nil
+	}
+}
+
+// replicaSetName returns the value of the --replSet argument of cReq, if any.
+func replicaSetName(cReq tc.ContainerRequest) (name string, exists bool) {
+	for i, arg := range cReq.Cmd {
+		if arg == argReplSet && i+1 < len(cReq.Cmd) {
+			return cReq.Cmd[i+1], true
+		}
+	}
+	return
+}
+
+// makeConnectionStringOptions returns the query string the connection string of a Container made from cReq requires.
+// caFile is the host path of the certificate authority of a Container started with WithTLS.
+func makeConnectionStringOptions(cReq tc.ContainerRequest, caFile string) string {
+	var opts []string
+	if name, exists := replicaSetName(cReq); exists {
+		opts = append(opts, "replicaSet="+url.QueryEscape(name), "directConnection=true")
+	}
+	if caFile != "" {
+		opts = append(opts, "tls=true", "tlsCAFile="+url.QueryEscape(caFile))
+	}
+
+	if len(opts) == 0 {
+		return ""
+	}
+	return "/?" + strings.Join(opts, "&")
+}
+
+// initiateReplicaSet initiates a single member replica set and waits for the member to become PRIMARY.
+func initiateReplicaSet(ctx context.Context, connectionString, name string) error {
+	client, err := mongo.Connect(ctx, mongooptions.Client().ApplyURI(connectionString))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	admin := client.Database("admin")
+	if err := replSetInitiate(ctx, admin, name, false, "localhost:27017"); err != nil {
+		return err
+	}
+
+	return waitForPrimary(ctx, admin)
+}
+
+// replSetInitiate initiates a replica set with the given member hosts on the server admin is connected to.
+// A replica set that is already initiated is not an error.
+func replSetInitiate(ctx context.Context, admin *mongo.Database, name string, configsvr bool, hosts ...string) error {
+	members := bson.A{}
+	for i, host := range hosts {
+		members = append(members, bson.D{{Key: "_id", Value: i}, {Key: "host", Value: host}})
+	}
+
+	err := admin.RunCommand(ctx, bson.D{
+		{Key: "replSetInitiate", Value: bson.D{
+			{Key: "_id", Value: name},
+			{Key: "configsvr", Value: configsvr},
+			{Key: "members", Value: members},
+		}},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == errCodeAlreadyInitialized) {
+		return err
+	}
+	return nil
+}
+
+// waitForPrimary blocks until the server admin is connected to reports itself as PRIMARY.
+func waitForPrimary(ctx context.Context, admin *mongo.Database) error {
+	ticker := time.NewTicker(primaryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var result struct {
+			IsMaster bool `bson:"ismaster"`
+		}
+		if err := admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result); err != nil {
+			return err
+		}
+		if result.IsMaster {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replica set member did not become primary: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
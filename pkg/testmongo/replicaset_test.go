@@ -0,0 +1,46 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestWithReplicaSet_Run(t *testing.T) {
+	t.Parallel()
+
+	t.Run("supports transactions", func(t *testing.T) {
+		t.Parallel()
+		con, err := RunTest(t, WithReplicaSet())
+		assert.NoError(t, err)
+		assert.Contains(t, con.ConnectionString, "replicaSet=rs0")
+
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		ctx := context.Background()
+		collection := db.Collection("orders")
+		assert.NoError(t, db.CreateCollection(ctx, "orders"))
+
+		session, err := db.Client().StartSession()
+		assert.NoError(t, err)
+		defer session.EndSession(ctx)
+
+		_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			return collection.InsertOne(sessCtx, bson.D{{Key: "status", Value: "paid"}})
+		})
+		assert.NoError(t, err)
+	})
+	t.Run("with root user", func(t *testing.T) {
+		t.Parallel()
+		con, err := RunTest(t, WithRootUser("user", "pass"), WithReplicaSet())
+		assert.NoError(t, err)
+
+		client, err := con.NewTestClient(t)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Ping(context.Background(), nil))
+	})
+}
@@ -0,0 +1,83 @@
+package testmongo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ResetCollections deletes every document from every collection of db while keeping the collections,
+// their indexes and their validators. It is much faster than creating a new database for every test.
+// Note: A default context is used with a timeout of two minutes.
+func ResetCollections(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return ResetCollectionsWithContext(ctx, db)
+}
+
+// ResetCollectionsWithContext deletes every document from every collection of db while keeping the collections,
+// their indexes and their validators. Views and system collections are left untouched.
+func ResetCollectionsWithContext(ctx context.Context, db *mongo.Database) error {
+	collections, err := listCollections(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		if _, err := db.Collection(collection.Name).DeleteMany(ctx, bson.D{}); err != nil {
+			return fmt.Errorf("resetting collection %s: %w", collection.Name, err)
+		}
+	}
+	return nil
+}
+
+// RecreateCollections drops every collection of db, then creates the collections of spec.
+// Use it with a Spec from CaptureSpec when tests also change indexes or validators.
+// Note: A default context is used with a timeout of two minutes.
+func RecreateCollections(db *mongo.Database, spec *Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RecreateCollectionsWithContext(ctx, db, spec)
+}
+
+// RecreateCollectionsWithContext drops every collection of db, then creates the collections of spec.
+// Use it with a Spec from CaptureSpec when tests also change indexes or validators.
+// Views and system collections are left untouched.
+func RecreateCollectionsWithContext(ctx context.Context, db *mongo.Database, spec *Spec) error {
+	collections, err := listCollections(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		if err := db.Collection(collection.Name).Drop(ctx); err != nil {
+			return fmt.Errorf("dropping collection %s: %w", collection.Name, err)
+		}
+	}
+
+	return spec.Apply(ctx, db)
+}
+
+// ResetCollectionsOnCleanup resets every collection of db with ResetCollections after the test finishes.
+// Call it at the start of each subtest that shares db.
+func ResetCollectionsOnCleanup(t testing.TB, db *mongo.Database) {
+	t.Cleanup(func() {
+		if err := ResetCollections(db); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// RecreateCollectionsOnCleanup recreates every collection of db from spec with RecreateCollections after the test finishes.
+// Call it at the start of each subtest that shares db.
+func RecreateCollectionsOnCleanup(t testing.TB, db *mongo.Database, spec *Spec) {
+	t.Cleanup(func() {
+		if err := RecreateCollections(db, spec); err != nil {
+			t.Error(err)
+		}
+	})
+}
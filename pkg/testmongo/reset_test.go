@@ -0,0 +1,69 @@
+package testmongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestResetCollections(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	spec, err := LoadSpec(os.DirFS("testdata"), "spec.yaml")
+	assert.NoError(t, err)
+
+	countOrders := func(t *testing.T, db *mongo.Database) int64 {
+		count, err := db.Collection("orders").CountDocuments(context.Background(), bson.D{})
+		assert.NoError(t, err)
+		return count
+	}
+
+	t.Run("keeps indexes and validators", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.WithDatabaseSetup(spec.Apply).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			t.Run("subtest", func(t *testing.T) {
+				ResetCollectionsOnCleanup(t, db)
+				assert.EqualValues(t, 0, countOrders(t, db))
+				_, err := db.Collection("orders").InsertOne(ctx, bson.D{{Key: "customerId", Value: "c1"}, {Key: "total", Value: 10}})
+				assert.NoError(t, err)
+			})
+		}
+
+		assert.EqualValues(t, 0, countOrders(t, db))
+		diffs, err := spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+	t.Run("recreates captured collections", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.WithDatabaseSetup(spec.Apply).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		captured, err := CaptureSpec(db)
+		assert.NoError(t, err)
+
+		diffs, err := spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+
+		t.Run("subtest", func(t *testing.T) {
+			RecreateCollectionsOnCleanup(t, db, captured)
+			_, err := db.Collection("orders").Indexes().DropOne(ctx, "expire")
+			assert.NoError(t, err)
+			_, err = db.Collection("extra").InsertOne(ctx, bson.D{})
+			assert.NoError(t, err)
+		})
+
+		diffs, err = spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+}
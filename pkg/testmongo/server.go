@@ -0,0 +1,102 @@
+package testmongo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	dataDir                  = "/data/db"
+	minWiredTigerCacheSizeGB = 0.25
+)
+
+// ProfilingLevel is the level of the database profiler, see https://docs.mongodb.com/manual/reference/command/profile.
+type ProfilingLevel int
+
+const (
+	// ProfilingOff disables the profiler.
+	ProfilingOff ProfilingLevel = iota
+	// ProfilingSlowOperations profiles operations slower than the slow operation threshold.
+	ProfilingSlowOperations
+	// ProfilingAllOperations profiles every operation.
+	ProfilingAllOperations
+)
+
+// WithSetParameter sets the server parameter name to value with `--setParameter`, e.g., WithSetParameter("transactionLifetimeLimitSeconds", "5").
+func WithSetParameter(name, value string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if name == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("invalid server parameter name %q", name)
+		}
+		request.Cmd = append(request.Cmd, "--setParameter", name+"="+value)
+		return nil
+	}
+}
+
+// WithWiredTigerCacheSize limits the WiredTiger cache to the given size in gigabytes. The minimum is 0.25.
+// A small cache keeps the memory of many parallel Containers in check.
+func WithWiredTigerCacheSize(gigabytes float64) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if gigabytes < minWiredTigerCacheSizeGB {
+			return fmt.Errorf("wiredTiger cache size must be at least %v GB", minWiredTigerCacheSizeGB)
+		}
+		request.Cmd = append(request.Cmd, "--wiredTigerCacheSizeGB", strconv.FormatFloat(gigabytes, 'f', -1, 64))
+		return nil
+	}
+}
+
+// WithNoTableScan starts mongod with `--notablescan`, which fails every query that requires a collection scan.
+// Use it to catch queries that are missing an index.
+// Note: mongod exempts queries with an empty filter and queries on the `system.*` collections and the `local` database.
+func WithNoTableScan() options.Option {
+	return withArgs("--notablescan")
+}
+
+// WithProfiling sets the level of the database profiler of every database.
+// Profiled operations are written to the `system.profile` collection of their database.
+func WithProfiling(level ProfilingLevel) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if level < ProfilingOff || level > ProfilingAllOperations {
+			return fmt.Errorf("invalid profiling level %d", level)
+		}
+		request.Cmd = append(request.Cmd, "--profile", strconv.Itoa(int(level)))
+		return nil
+	}
+}
+
+// WithSlowOperationThreshold sets the time in milliseconds above which operations are profiled by ProfilingSlowOperations.
+func WithSlowOperationThreshold(milliseconds int) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if milliseconds < 0 {
+			return errors.New("slow operation threshold must not be negative")
+		}
+		request.Cmd = append(request.Cmd, "--slowms", strconv.Itoa(milliseconds))
+		return nil
+	}
+}
+
+// WithTmpfsStorage mounts the data directory of mongod on a tmpfs so that nothing is written to disk.
+// size limits the tmpfs, e.g., `512m`, and is unlimited when empty.
+// Note: Data does not survive a restart of the Container.
+func WithTmpfsStorage(size string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		opts := "rw"
+		if size != "" {
+			if strings.Contains(size, ",") {
+				return fmt.Errorf("invalid tmpfs size %q", size)
+			}
+			opts += ",size=" + size
+		}
+
+		if request.Tmpfs == nil {
+			request.Tmpfs = make(map[string]string)
+		}
+		request.Tmpfs[dataDir] = opts
+		return nil
+	}
+}
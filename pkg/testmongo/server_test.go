@@ -0,0 +1,106 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tc "github.com/testcontainers/testcontainers-go"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWithSetParameter(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		err := WithSetParameter("transactionLifetimeLimitSeconds", "5")(&cReq)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"--setParameter", "transactionLifetimeLimitSeconds=5"}, cReq.Cmd)
+	})
+	t.Run("invalid name", func(t *testing.T) {
+		for _, name := range []string{"", "a=b"} {
+			cReq := tc.ContainerRequest{}
+			assert.Error(t, WithSetParameter(name, "1")(&cReq))
+		}
+	})
+}
+
+func TestWithWiredTigerCacheSize(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		err := WithWiredTigerCacheSize(0.25)(&cReq)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"--wiredTigerCacheSizeGB", "0.25"}, cReq.Cmd)
+	})
+	t.Run("too small", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.Error(t, WithWiredTigerCacheSize(0.1)(&cReq))
+	})
+}
+
+func TestWithProfiling(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithProfiling(ProfilingSlowOperations)(&cReq))
+		assert.NoError(t, WithSlowOperationThreshold(0)(&cReq))
+		assert.Equal(t, []string{"--profile", "1", "--slowms", "0"}, cReq.Cmd)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.Error(t, WithProfiling(3)(&cReq))
+		assert.Error(t, WithSlowOperationThreshold(-1)(&cReq))
+	})
+}
+
+func TestWithTmpfsStorage(t *testing.T) {
+	t.Run("unlimited", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithTmpfsStorage("")(&cReq))
+		assert.Equal(t, map[string]string{"/data/db": "rw"}, cReq.Tmpfs)
+	})
+	t.Run("size", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithTmpfsStorage("512m")(&cReq))
+		assert.Equal(t, map[string]string{"/data/db": "rw,size=512m"}, cReq.Tmpfs)
+	})
+	t.Run("invalid size", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.Error(t, WithTmpfsStorage("512m,mode=777")(&cReq))
+	})
+}
+
+func TestRun_ServerOptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	con, err := RunTest(t,
+		WithNoTableScan(),
+		WithWiredTigerCacheSize(0.25),
+		WithProfiling(ProfilingAllOperations),
+		WithSetParameter("transactionLifetimeLimitSeconds", "5"),
+		WithTmpfsStorage("256m"),
+	)
+	assert.NoError(t, err)
+
+	db, err := con.NewTestDatabase(t)
+	assert.NoError(t, err)
+
+	orders := db.Collection("orders")
+	_, err = orders.InsertOne(ctx, bson.D{{Key: "customerId", Value: "c1"}})
+	assert.NoError(t, err)
+
+	err = orders.FindOne(ctx, bson.D{{Key: "customerId", Value: "c1"}}).Err()
+	assert.Error(t, err, "collection scans are rejected")
+
+	var result bson.M
+	err = db.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "getParameter", Value: 1},
+		{Key: "transactionLifetimeLimitSeconds", Value: 1},
+	}).Decode(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, result["transactionLifetimeLimitSeconds"])
+
+	result = bson.M{}
+	err = db.RunCommand(ctx, bson.D{{Key: "profile", Value: -1}}).Decode(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, ProfilingAllOperations, result["was"])
+}
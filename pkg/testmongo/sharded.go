@@ -0,0 +1,245 @@
+package testmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	configServerReplicaSetName = "cfg"
+	configServerAliasPrefix    = "cfg"
+	shardReplicaSetPrefix      = "shard"
+	routerAlias                = "mongos"
+)
+
+// ShardedCluster is a config server replica set, one or more single member shards and a mongos router
+// each running in their own docker Container on a shared docker network.
+type ShardedCluster struct {
+	ConfigServers *ReplicaSet
+	Shards        []*ReplicaSet
+	// Router is the mongos Container. Use it to create clients and databases, e.g., Router.NewTestDatabase.
+	Router *Container
+	// ConnectionString is the connection string of the Router.
+	ConnectionString string
+
+	network tc.Network
+}
+
+// RunShardedCluster creates and starts a sharded cluster with the given number of shards using the `mongo` image.
+// Every mongod receives the same options. WithReplicaSet, WithRootUser and WithTLS are not supported.
+// A default context is used with a timeout of two minutes. To customize use RunShardedClusterWithContext.
+func RunShardedCluster(shards int, opts ...options.Option) (*ShardedCluster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunShardedClusterWithContext(ctx, shards, opts...)
+}
+
+// RunShardedClusterWithContext creates and starts a sharded cluster with the given number of shards using the `mongo` image.
+// Every mongod receives the same options. WithReplicaSet, WithRootUser and WithTLS are not supported.
+// A context can be provided to configure things such as timeout.
+func RunShardedClusterWithContext(ctx context.Context, shards int, opts ...options.Option) (cluster *ShardedCluster, err error) {
+	if shards < 1 {
+		return nil, fmt.Errorf("a sharded cluster requires at least one shard, got %d", shards)
+	}
+
+	probe, err := makeContainerRequest(opts)
+	if err != nil {
+		return
+	}
+	if _, exists := replicaSetName(probe); exists {
+		return nil, errors.New("sharded clusters name their own replica sets, remove WithReplicaSet")
+	}
+	if makeRootUserPrefix(probe) != "" {
+		return nil, errors.New("sharded clusters do not support WithRootUser")
+	}
+	if tlsEnabled(probe) {
+		return nil, errors.New("sharded clusters do not support WithTLS")
+	}
+
+	network, networkName, err := newNetwork(ctx)
+	if err != nil {
+		return
+	}
+
+	cluster = &ShardedCluster{network: network}
+	defer func() {
+		if err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+			defer cancel()
+			_ = cluster.Terminate(ctx)
+			cluster = nil
+		}
+	}()
+
+	cluster.ConfigServers, err = startReplicaSet(ctx, networkName, configServerAliasPrefix, 1, true, append(opts[:len(opts):len(opts)],
+		WithReplicaSetName(configServerReplicaSetName),
+		withArgs("--configsvr", "--port", fmt.Sprint(memberPort)),
+	))
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < shards; i++ {
+		name := fmt.Sprintf("%s%d", shardReplicaSetPrefix, i)
+		shard, err := startReplicaSet(ctx, networkName, name+"-", 1, false, append(opts[:len(opts):len(opts)],
+			WithReplicaSetName(name),
+			withArgs("--shardsvr", "--port", fmt.Sprint(memberPort)),
+		))
+		if err != nil {
+			return cluster, err
+		}
+		cluster.Shards = append(cluster.Shards, shard)
+	}
+
+	routerReq, err := makeContainerRequest(opts)
+	if err != nil {
+		return
+	}
+	routerReq.Cmd = []string{
+		"mongos",
+		"--configdb", fmt.Sprintf("%s/%s0:%d", configServerReplicaSetName, configServerAliasPrefix, memberPort),
+		"--bind_ip_all",
+		"--port", fmt.Sprint(memberPort),
+	}
+	routerReq.Networks = []string{networkName}
+	routerReq.NetworkAliases = map[string][]string{networkName: {routerAlias}}
+
+	cluster.Router, err = startContainer(ctx, routerReq)
+	if err != nil {
+		return
+	}
+	cluster.ConnectionString = cluster.Router.ConnectionString
+
+	client, err := cluster.Router.NewClientWithContext(ctx)
+	if err != nil {
+		return
+	}
+	defer client.Disconnect(ctx)
+
+	for i, shard := range cluster.Shards {
+		shardHost := fmt.Sprintf("%s/%s%d-0:%d", shard.Name, shardReplicaSetPrefix, i, memberPort)
+		if err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "addShard", Value: shardHost}}).Err(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// RunShardedClusterTest creates and starts a sharded cluster with the given number of shards using the `mongo` image.
+// Every Container and the network are automatically removed after the test is finished.
+// A default context is used with a timeout of two minutes. To customize use RunShardedClusterTestWithContext.
+func RunShardedClusterTest(t *testing.T, shards int, opts ...options.Option) (*ShardedCluster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunShardedClusterTestWithContext(t, ctx, shards, opts...)
+}
+
+// RunShardedClusterTestWithContext creates and starts a sharded cluster with the given number of shards using the `mongo` image.
+// A context can be provided to configure things such as timeout.
+// Every Container and the network are automatically removed after the test is finished.
+func RunShardedClusterTestWithContext(t *testing.T, ctx context.Context, shards int, opts ...options.Option) (*ShardedCluster, error) {
+	cluster, err := RunShardedClusterWithContext(ctx, shards, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if err := cluster.Terminate(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return cluster, nil
+}
+
+// ShardCollection enables sharding for database and shards collection on the given shard key,
+// e.g., bson.D{{Key: "customerId", Value: 1}} or bson.D{{Key: "_id", Value: "hashed"}}.
+func (sc *ShardedCluster) ShardCollection(ctx context.Context, database, collection string, key bson.D) error {
+	return sc.adminCommands(ctx,
+		bson.D{{Key: "enableSharding", Value: database}},
+		bson.D{{Key: "shardCollection", Value: database + "." + collection}, {Key: "key", Value: key}},
+	)
+}
+
+// SplitAt splits the chunk of a sharded collection that contains middle into two chunks at middle.
+func (sc *ShardedCluster) SplitAt(ctx context.Context, database, collection string, middle bson.D) error {
+	return sc.adminCommands(ctx,
+		bson.D{{Key: "split", Value: database + "." + collection}, {Key: "middle", Value: middle}},
+	)
+}
+
+// MoveChunk moves the chunk of a sharded collection that contains find to the shard with the given index in Shards.
+func (sc *ShardedCluster) MoveChunk(ctx context.Context, database, collection string, find bson.D, shard int) error {
+	if shard < 0 || shard >= len(sc.Shards) {
+		return fmt.Errorf("shard %d does not exist", shard)
+	}
+	return sc.adminCommands(ctx,
+		bson.D{{Key: "moveChunk", Value: database + "." + collection}, {Key: "find", Value: find}, {Key: "to", Value: sc.Shards[shard].Name}},
+	)
+}
+
+// Terminate terminates every Container of the ShardedCluster and removes its network.
+// Every Container is terminated even if another fails to, the first error is returned.
+func (sc *ShardedCluster) Terminate(ctx context.Context) error {
+	var firstErr error
+	if sc.Router != nil {
+		if err := sc.Router.Terminate(ctx); err != nil {
+			firstErr = fmt.Errorf("error terminating router: %w", err)
+		}
+	}
+
+	for _, shard := range sc.Shards {
+		if err := shard.Terminate(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error terminating shard %s: %w", shard.Name, err)
+		}
+	}
+
+	if sc.ConfigServers != nil {
+		if err := sc.ConfigServers.Terminate(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error terminating config servers: %w", err)
+		}
+	}
+
+	if err := sc.network.Remove(ctx); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error removing network: %w", err)
+	}
+
+	return firstErr
+}
+
+func (sc *ShardedCluster) adminCommands(ctx context.Context, cmds ...bson.D) error {
+	client, err := sc.Router.NewClientWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	for _, cmd := range cmds {
+		err := client.Database("admin").RunCommand(ctx, cmd).Err()
+		var cmdErr mongo.CommandError
+		/// Enabling sharding twice is reported as AlreadyInitialized by older servers.
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == errCodeAlreadyInitialized) {
+			return err
+		}
+	}
+	return nil
+}
+
+// withArgs appends the given arguments to the container command.
+func withArgs(args ...string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		request.Cmd = append(request.Cmd, args...)
+		return nil
+	}
+}
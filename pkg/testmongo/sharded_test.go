@@ -0,0 +1,57 @@
+package testmongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRunShardedCluster(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rejects replica set option", func(t *testing.T) {
+		t.Parallel()
+		cluster, err := RunShardedCluster(2, WithReplicaSet())
+		assert.Error(t, err)
+		assert.Nil(t, cluster)
+	})
+	t.Run("rejects root user", func(t *testing.T) {
+		t.Parallel()
+		cluster, err := RunShardedCluster(2, WithRootUser("user", "pass"))
+		assert.Error(t, err)
+		assert.Nil(t, cluster)
+	})
+	t.Run("rejects TLS", func(t *testing.T) {
+		t.Parallel()
+		cluster, err := RunShardedCluster(1, WithTLS())
+		assert.EqualError(t, err, "sharded clusters do not support WithTLS")
+		assert.Nil(t, cluster)
+	})
+	t.Run("shards collection", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		cluster, err := RunShardedClusterTest(t, 2)
+		assert.NoError(t, err)
+		assert.Len(t, cluster.Shards, 2)
+		assert.NotEmpty(t, cluster.ConnectionString)
+
+		db, err := cluster.Router.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		assert.NoError(t, cluster.ShardCollection(ctx, db.Name(), "orders", bson.D{{Key: "customer", Value: 1}}))
+		assert.NoError(t, cluster.SplitAt(ctx, db.Name(), "orders", bson.D{{Key: "customer", Value: 100}}))
+		assert.NoError(t, cluster.MoveChunk(ctx, db.Name(), "orders", bson.D{{Key: "customer", Value: 100}}, 1))
+
+		_, err = db.Collection("orders").InsertMany(ctx, []interface{}{
+			bson.D{{Key: "customer", Value: 1}},
+			bson.D{{Key: "customer", Value: 200}},
+		})
+		assert.NoError(t, err)
+
+		count, err := db.Collection("orders").CountDocuments(ctx, bson.D{})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, count)
+	})
+}
@@ -0,0 +1,191 @@
+package testmongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	snapshotDir = "/tmp/testdeps-snapshots"
+	localHost   = "localhost:27017"
+)
+
+// Snapshot is a mongodump archive of a single database stored inside the Container that took it.
+// It remains available until the Container is terminated.
+type Snapshot struct {
+	// Database is the name of the database the Snapshot was taken of.
+	Database string
+
+	path      string
+	container *Container
+}
+
+// Snapshot dumps database with mongodump into an archive inside the Container.
+// Build a large dataset once, take a Snapshot, then restore it for every test with NewTestDatabaseFromSnapshot.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) Snapshot(database string) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.SnapshotWithContext(ctx, database)
+}
+
+// SnapshotWithContext dumps database with mongodump into an archive inside the Container.
+// Build a large dataset once, take a Snapshot, then restore it for every test with NewTestDatabaseFromSnapshot.
+func (c *Container) SnapshotWithContext(ctx context.Context, database string) (*Snapshot, error) {
+	uri, err := makeLocalConnectionString(c.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Database:  database,
+		path:      fmt.Sprintf("%s/%s.archive", snapshotDir, common.GenerateId()),
+		container: c,
+	}
+
+	if err := c.exec(ctx, "mkdir", "-p", snapshotDir); err != nil {
+		return nil, err
+	}
+	if err := c.exec(ctx, "mongodump", "--quiet", "--uri="+uri, "--db="+database, "--archive="+snapshot.path); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Restore restores snapshot into database with mongorestore. Collections of database that are part of snapshot are replaced.
+// The snapshot must have been taken by the same Container.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) Restore(snapshot *Snapshot, database string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.RestoreWithContext(ctx, snapshot, database)
+}
+
+// RestoreWithContext restores snapshot into database with mongorestore. Collections of database that are part of snapshot are replaced.
+// The snapshot must have been taken by the same Container.
+func (c *Container) RestoreWithContext(ctx context.Context, snapshot *Snapshot, database string) error {
+	if snapshot.container == nil || snapshot.container.Container != c.Container {
+		return errors.New("snapshot was taken by a different container")
+	}
+
+	uri, err := makeLocalConnectionString(c.ConnectionString)
+	if err != nil {
+		return err
+	}
+
+	return c.exec(ctx, "mongorestore", "--quiet", "--drop",
+		"--uri="+uri,
+		"--archive="+snapshot.path,
+		"--nsInclude="+snapshot.Database+".*",
+		"--nsFrom="+snapshot.Database+".*",
+		"--nsTo="+database+".*",
+	)
+}
+
+// NewTestDatabaseFromSnapshot restores snapshot into a new database with a random name within the Container.
+// The database is automatically dropped after the test finishes, the same as with NewTestDatabase.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewTestDatabaseFromSnapshot(t testing.TB, snapshot *Snapshot, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewTestDatabaseFromSnapshotWithContext(t, ctx, snapshot, opts...)
+}
+
+// NewTestDatabaseFromSnapshotWithContext restores snapshot into a new database with a random name within the Container.
+// The database is automatically dropped after the test finishes, the same as with NewTestDatabase.
+// Setups from WithDatabaseSetup run after the snapshot is restored.
+func (c *Container) NewTestDatabaseFromSnapshotWithContext(t testing.TB, ctx context.Context, snapshot *Snapshot, opts ...*options.DatabaseOptions) (*mongo.Database, error) {
+	name := common.GenerateId()
+
+	if err := c.RestoreWithContext(ctx, snapshot, name); err != nil {
+		return nil, err
+	}
+
+	db, err := c.NewDatabaseWithContext(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dropOnCleanup(t, db)
+	return db, nil
+}
+
+// exec runs cmd inside the Container and fails unless it exits successfully.
+// The error contains the output of cmd, since tc.Container.Exec only reports the exit code.
+func (c *Container) exec(ctx context.Context, cmd ...string) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	created, err := cli.ContainerExecCreate(ctx, c.GetContainerID(), types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	attached, err := cli.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return err
+	}
+	defer attached.Close()
+
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attached.Reader); err != nil {
+		return err
+	}
+
+	inspected, err := cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if inspected.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", cmd[0], inspected.ExitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// makeLocalConnectionString returns connStr with its host replaced by the address mongod listens on inside the Container.
+func makeLocalConnectionString(connStr string) (string, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(u.Host, ",") {
+		return "", errors.New("snapshots require a single host connection string")
+	}
+
+	u.Host = localHost
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	if query.Get(queryTLSCertificateKeyFile) != "" {
+		return "", errors.New("snapshots do not support x.509 users")
+	}
+	/// The certificate authority file of a Container started with WithTLS is on the host, mongod has its own copy.
+	if query.Get(queryTLSCAFile) != "" {
+		query.Set(queryTLSCAFile, tlsCAFile)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
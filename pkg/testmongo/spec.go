@@ -0,0 +1,662 @@
+package testmongo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	errCodeNamespaceExists = 48
+	idIndexName            = "_id_"
+)
+
+// Spec declares the collections of a database along with their validators and indexes.
+// Specs are usually loaded from a YAML or JSON file with LoadSpec, e.g.,
+//
+//	collections:
+//	  - name: orders
+//	    validator:
+//	      $jsonSchema:
+//	        required: [customerId]
+//	    indexes:
+//	      - keys: {customerId: 1, createdAt: -1}
+//	      - name: expire
+//	        keys: {createdAt: 1}
+//	        expireAfterSeconds: 3600
+//
+// Values are MongoDB Extended JSON so types such as {$date: ...} may be used in validators and partial filters.
+type Spec struct {
+	Collections []CollectionSpec `bson:"collections"`
+}
+
+// CollectionSpec declares a single collection of a Spec.
+type CollectionSpec struct {
+	Name      string `bson:"name"`
+	Validator bson.D `bson:"validator,omitempty"`
+	// ValidationLevel is one of `off`, `strict` or `moderate`. The server default is used when empty.
+	ValidationLevel string `bson:"validationLevel,omitempty"`
+	// ValidationAction is one of `error` or `warn`. The server default is used when empty.
+	ValidationAction string      `bson:"validationAction,omitempty"`
+	Indexes          []IndexSpec `bson:"indexes,omitempty"`
+}
+
+// IndexSpec declares a single index of a CollectionSpec.
+type IndexSpec struct {
+	// Name defaults to the name the server would generate, e.g., `customerId_1_createdAt_-1`.
+	Name string `bson:"name,omitempty"`
+	Keys bson.D `bson:"keys"`
+	// ExpireAfterSeconds makes the index a TTL index.
+	ExpireAfterSeconds      *int32 `bson:"expireAfterSeconds,omitempty"`
+	Unique                  bool   `bson:"unique,omitempty"`
+	Sparse                  bool   `bson:"sparse,omitempty"`
+	PartialFilterExpression bson.D `bson:"partialFilterExpression,omitempty"`
+}
+
+// liveIndex is an index as reported by the listIndexes command.
+type liveIndex struct {
+	Name                    string   `bson:"name"`
+	Keys                    bson.Raw `bson:"key"`
+	ExpireAfterSeconds      *int32   `bson:"expireAfterSeconds"`
+	Unique                  bool     `bson:"unique"`
+	Sparse                  bool     `bson:"sparse"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression"`
+}
+
+// LoadSpec reads and parses the Spec file with the given name from fsys.
+// Use os.DirFS to load specs from a directory, e.g., LoadSpec(os.DirFS("testdata"), "schema.yaml").
+func LoadSpec(fsys fs.FS, name string) (*Spec, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing spec %s: %w", name, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses a Spec written in either YAML or JSON.
+// Unknown keys are rejected, so a misspelled option such as `expireAfterSecond` does not silently go missing.
+func ParseSpec(data []byte) (*Spec, error) {
+	ext := data
+	if !json.Valid(data) {
+		var err error
+		if ext, err = yamlToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc bson.Raw
+	if err := bson.UnmarshalExtJSON(ext, false, &doc); err != nil {
+		return nil, err
+	}
+	if err := checkSpecKeys(doc); err != nil {
+		return nil, err
+	}
+
+	var spec Spec
+	if err := bson.Unmarshal(doc, &spec); err != nil {
+		return nil, err
+	}
+
+	for i, collection := range spec.Collections {
+		if collection.Name == "" {
+			return nil, fmt.Errorf("collection %d has no name", i)
+		}
+		for j, index := range collection.Indexes {
+			if len(index.Keys) == 0 {
+				return nil, fmt.Errorf("index %d of collection %s has no keys", j, collection.Name)
+			}
+		}
+	}
+
+	return &spec, nil
+}
+
+var (
+	specKeys           = bsonKeys(Spec{})
+	collectionSpecKeys = bsonKeys(CollectionSpec{})
+	indexSpecKeys      = bsonKeys(IndexSpec{})
+)
+
+// checkSpecKeys returns an error naming the first key of doc, or of its collections and indexes,
+// that is not a field of the Spec.
+func checkSpecKeys(doc bson.Raw) error {
+	if err := checkKeys(doc, specKeys, "spec"); err != nil {
+		return err
+	}
+
+	collections, _ := doc.Lookup("collections").ArrayOK()
+	values, _ := collections.Values()
+	for i, value := range values {
+		collection, ok := value.DocumentOK()
+		if !ok {
+			continue
+		}
+
+		where := fmt.Sprintf("collection %d", i)
+		if name, ok := collection.Lookup("name").StringValueOK(); ok {
+			where = "collection " + name
+		}
+		if err := checkKeys(collection, collectionSpecKeys, where); err != nil {
+			return err
+		}
+
+		indexes, _ := collection.Lookup("indexes").ArrayOK()
+		indexValues, _ := indexes.Values()
+		for j, indexValue := range indexValues {
+			if index, ok := indexValue.DocumentOK(); ok {
+				if err := checkKeys(index, indexSpecKeys, fmt.Sprintf("index %d of %s", j, where)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkKeys returns an error naming the first key of doc that is not one of known.
+func checkKeys(doc bson.Raw, known map[string]bool, where string) error {
+	elems, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		if !known[elem.Key()] {
+			return fmt.Errorf("unknown key %q in %s", elem.Key(), where)
+		}
+	}
+	return nil
+}
+
+// bsonKeys returns the bson keys of the fields of the struct v.
+func bsonKeys(v interface{}) map[string]bool {
+	t := reflect.TypeOf(v)
+	keys := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys[strings.Split(t.Field(i).Tag.Get("bson"), ",")[0]] = true
+	}
+	return keys
+}
+
+// Apply creates every collection and index of the Spec in db.
+// Collections that already exist have their validator replaced.
+// Apply is a DatabaseSetup so every test database can be provisioned with con.WithDatabaseSetup(spec.Apply).
+func (s *Spec) Apply(ctx context.Context, db *mongo.Database) error {
+	for _, collection := range s.Collections {
+		if err := collection.create(ctx, db); err != nil {
+			return fmt.Errorf("creating collection %s: %w", collection.Name, err)
+		}
+
+		if len(collection.Indexes) == 0 {
+			continue
+		}
+
+		models := make([]mongo.IndexModel, 0, len(collection.Indexes))
+		for _, index := range collection.Indexes {
+			models = append(models, index.model())
+		}
+		if _, err := db.Collection(collection.Name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("creating indexes of collection %s: %w", collection.Name, err)
+		}
+	}
+	return nil
+}
+
+// Diff compares db against the Spec and returns a description of every difference.
+// An empty result means db matches the Spec. Collections and indexes that are not part of the Spec are reported too,
+// except the `_id` index and system collections.
+// Note: A default context is used with a timeout of two minutes.
+func (s *Spec) Diff(db *mongo.Database) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return s.DiffWithContext(ctx, db)
+}
+
+// DiffWithContext compares db against the Spec and returns a description of every difference.
+// An empty result means db matches the Spec. Collections and indexes that are not part of the Spec are reported too,
+// except the `_id` index and system collections.
+func (s *Spec) DiffWithContext(ctx context.Context, db *mongo.Database) ([]string, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]*mongo.CollectionSpecification, len(specs))
+	for _, spec := range specs {
+		live[spec.Name] = spec
+	}
+
+	var diffs []string
+	declared := make(map[string]bool, len(s.Collections))
+	for _, collection := range s.Collections {
+		declared[collection.Name] = true
+
+		liveSpec, exists := live[collection.Name]
+		if !exists {
+			diffs = append(diffs, fmt.Sprintf("collection %s is missing", collection.Name))
+			continue
+		}
+
+		diffs = append(diffs, collection.diffOptions(liveSpec.Options)...)
+
+		indexDiffs, err := collection.diffIndexes(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, indexDiffs...)
+	}
+
+	for _, spec := range specs {
+		if !declared[spec.Name] && !strings.HasPrefix(spec.Name, "system.") {
+			diffs = append(diffs, fmt.Sprintf("collection %s is not in the spec", spec.Name))
+		}
+	}
+
+	return diffs, nil
+}
+
+// CaptureSpec returns a Spec of the collections, validators and indexes db currently has.
+// Capture a shared database once it is set up, then recreate it between tests with RecreateCollections.
+// Note: A default context is used with a timeout of two minutes.
+func CaptureSpec(db *mongo.Database) (*Spec, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return CaptureSpecWithContext(ctx, db)
+}
+
+// CaptureSpecWithContext returns a Spec of the collections, validators and indexes db currently has.
+// Capture a shared database once it is set up, then recreate it between tests with RecreateCollections.
+// Views and system collections are not captured.
+func CaptureSpecWithContext(ctx context.Context, db *mongo.Database) (*Spec, error) {
+	specs, err := listCollections(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{}
+	for _, liveSpec := range specs {
+		collection := CollectionSpec{Name: liveSpec.Name}
+		if validator, ok := liveSpec.Options.Lookup("validator").DocumentOK(); ok {
+			if err := bson.Unmarshal(validator, &collection.Validator); err != nil {
+				return nil, err
+			}
+		}
+		collection.ValidationLevel, _ = liveSpec.Options.Lookup("validationLevel").StringValueOK()
+		collection.ValidationAction, _ = liveSpec.Options.Lookup("validationAction").StringValueOK()
+
+		indexes, err := listIndexes(ctx, db.Collection(liveSpec.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			if index.Name == idIndexName {
+				continue
+			}
+			indexSpec, err := index.spec()
+			if err != nil {
+				return nil, err
+			}
+			collection.Indexes = append(collection.Indexes, indexSpec)
+		}
+
+		spec.Collections = append(spec.Collections, collection)
+	}
+
+	return spec, nil
+}
+
+func (c CollectionSpec) create(ctx context.Context, db *mongo.Database) error {
+	opts := options.CreateCollection()
+	if c.Validator != nil {
+		opts.SetValidator(c.Validator)
+	}
+	if c.ValidationLevel != "" {
+		opts.SetValidationLevel(c.ValidationLevel)
+	}
+	if c.ValidationAction != "" {
+		opts.SetValidationAction(c.ValidationAction)
+	}
+
+	err := db.CreateCollection(ctx, c.Name, opts)
+	var cmdErr mongo.CommandError
+	if err == nil || !(errors.As(err, &cmdErr) && cmdErr.Code == errCodeNamespaceExists) {
+		return err
+	}
+
+	/// The collection already exists, update its validation rules in place.
+	cmd := bson.D{{Key: "collMod", Value: c.Name}}
+	if c.Validator != nil {
+		cmd = append(cmd, bson.E{Key: "validator", Value: c.Validator})
+	}
+	if c.ValidationLevel != "" {
+		cmd = append(cmd, bson.E{Key: "validationLevel", Value: c.ValidationLevel})
+	}
+	if c.ValidationAction != "" {
+		cmd = append(cmd, bson.E{Key: "validationAction", Value: c.ValidationAction})
+	}
+	return db.RunCommand(ctx, cmd).Err()
+}
+
+func (c CollectionSpec) diffOptions(opts bson.Raw) []string {
+	var diffs []string
+
+	liveValidator, _ := opts.Lookup("validator").DocumentOK()
+	if c.Validator != nil || liveValidator != nil {
+		if !sameDocument(c.Validator, liveValidator) {
+			diffs = append(diffs, fmt.Sprintf("collection %s has validator %s, expected %s", c.Name, formatDocument(liveValidator), formatDocument(c.Validator)))
+		}
+	}
+
+	if level, _ := opts.Lookup("validationLevel").StringValueOK(); c.ValidationLevel != "" && level != c.ValidationLevel {
+		diffs = append(diffs, fmt.Sprintf("collection %s has validation level %q, expected %q", c.Name, level, c.ValidationLevel))
+	}
+	if action, _ := opts.Lookup("validationAction").StringValueOK(); c.ValidationAction != "" && action != c.ValidationAction {
+		diffs = append(diffs, fmt.Sprintf("collection %s has validation action %q, expected %q", c.Name, action, c.ValidationAction))
+	}
+
+	return diffs
+}
+
+func (c CollectionSpec) diffIndexes(ctx context.Context, db *mongo.Database) ([]string, error) {
+	indexes, err := listIndexes(ctx, db.Collection(c.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]liveIndex, len(indexes))
+	for _, index := range indexes {
+		live[index.Name] = index
+	}
+
+	var diffs []string
+	declared := make(map[string]bool, len(c.Indexes))
+	for _, index := range c.Indexes {
+		name := index.name()
+		declared[name] = true
+
+		liveIndex, exists := live[name]
+		if !exists {
+			diffs = append(diffs, fmt.Sprintf("index %s of collection %s is missing", name, c.Name))
+			continue
+		}
+
+		prefix := fmt.Sprintf("index %s of collection %s", name, c.Name)
+		if !sameDocument(index.Keys, liveIndex.Keys) {
+			diffs = append(diffs, fmt.Sprintf("%s has keys %s, expected %s", prefix, formatDocument(liveIndex.Keys), formatDocument(index.Keys)))
+		}
+		if index.Unique != liveIndex.Unique {
+			diffs = append(diffs, fmt.Sprintf("%s has unique %t, expected %t", prefix, liveIndex.Unique, index.Unique))
+		}
+		if index.Sparse != liveIndex.Sparse {
+			diffs = append(diffs, fmt.Sprintf("%s has sparse %t, expected %t", prefix, liveIndex.Sparse, index.Sparse))
+		}
+		if formatTTL(index.ExpireAfterSeconds) != formatTTL(liveIndex.ExpireAfterSeconds) {
+			diffs = append(diffs, fmt.Sprintf("%s has expireAfterSeconds %s, expected %s", prefix, formatTTL(liveIndex.ExpireAfterSeconds), formatTTL(index.ExpireAfterSeconds)))
+		}
+		if !sameDocument(index.PartialFilterExpression, liveIndex.PartialFilterExpression) {
+			diffs = append(diffs, fmt.Sprintf("%s has partialFilterExpression %s, expected %s", prefix, formatDocument(liveIndex.PartialFilterExpression), formatDocument(index.PartialFilterExpression)))
+		}
+	}
+
+	for _, index := range indexes {
+		if !declared[index.Name] && index.Name != idIndexName {
+			diffs = append(diffs, fmt.Sprintf("index %s of collection %s is not in the spec", index.Name, c.Name))
+		}
+	}
+
+	return diffs, nil
+}
+
+// spec returns the IndexSpec that creates the index.
+func (i liveIndex) spec() (IndexSpec, error) {
+	spec := IndexSpec{
+		Name:               i.Name,
+		ExpireAfterSeconds: i.ExpireAfterSeconds,
+		Unique:             i.Unique,
+		Sparse:             i.Sparse,
+	}
+	if err := bson.Unmarshal(i.Keys, &spec.Keys); err != nil {
+		return IndexSpec{}, err
+	}
+	if i.PartialFilterExpression != nil {
+		if err := bson.Unmarshal(i.PartialFilterExpression, &spec.PartialFilterExpression); err != nil {
+			return IndexSpec{}, err
+		}
+	}
+	return spec, nil
+}
+
+// listCollections returns the specifications of every collection of db that is neither a view nor a system collection.
+func listCollections(ctx context.Context, db *mongo.Database) ([]*mongo.CollectionSpecification, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{{Key: "type", Value: "collection"}})
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]*mongo.CollectionSpecification, 0, len(specs))
+	for _, spec := range specs {
+		if !strings.HasPrefix(spec.Name, "system.") {
+			collections = append(collections, spec)
+		}
+	}
+	return collections, nil
+}
+
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]liveIndex, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []liveIndex
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+func (i IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.name())
+	if i.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*i.ExpireAfterSeconds)
+	}
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if i.PartialFilterExpression != nil {
+		opts.SetPartialFilterExpression(i.PartialFilterExpression)
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+// name returns the name of the index, which defaults to the name the server generates from its keys.
+func (i IndexSpec) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	parts := make([]string, 0, len(i.Keys)*2)
+	for _, key := range i.Keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// sameDocument reports whether a and b are equal documents. Nil and empty documents are equal.
+// Numbers are compared by value so that, e.g., an int32 1 in a Spec matches a double 1 on the server.
+func sameDocument(a, b interface{}) bool {
+	return formatDocument(a) == formatDocument(b)
+}
+
+// formatDocument formats doc as relaxed Extended JSON with every number written as a double.
+func formatDocument(doc interface{}) string {
+	if doc == nil {
+		return "{}"
+	}
+	if raw, ok := doc.(bson.Raw); ok && raw == nil {
+		return "{}"
+	}
+	if d, ok := doc.(bson.D); ok && d == nil {
+		return "{}"
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+
+	var normalized bson.D
+	if err := bson.Unmarshal(data, &normalized); err != nil {
+		return fmt.Sprint(doc)
+	}
+
+	ext, err := bson.MarshalExtJSON(normalizeNumbers(normalized), false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+	return string(ext)
+}
+
+// normalizeNumbers converts every integer in value to a double.
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		normalized := make(bson.D, len(v))
+		for i, elem := range v {
+			normalized[i] = bson.E{Key: elem.Key, Value: normalizeNumbers(elem.Value)}
+		}
+		return normalized
+	case bson.A:
+		normalized := make(bson.A, len(v))
+		for i, elem := range v {
+			normalized[i] = normalizeNumbers(elem)
+		}
+		return normalized
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return value
+	}
+}
+
+func formatTTL(seconds *int32) string {
+	if seconds == nil {
+		return "none"
+	}
+	return strconv.Itoa(int(*seconds))
+}
+
+// yamlToJSON converts a YAML document to JSON preserving the order of keys, which matters for index keys.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeYAMLNode(&buf, &doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeYAMLNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		return writeYAMLNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeYAMLNode(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeYAMLNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeYAMLNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		return writeYAMLScalar(buf, node)
+	default:
+		return fmt.Errorf("unsupported YAML node at line %d", node.Line)
+	}
+	return nil
+}
+
+func writeYAMLScalar(buf *bytes.Buffer, node *yaml.Node) error {
+	var value interface{}
+	switch node.ShortTag() {
+	case "!!str":
+		value = node.Value
+	case "!!null":
+		value = nil
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err != nil {
+			return err
+		}
+		value = i
+	case "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return err
+		}
+		value = f
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return err
+		}
+		value = b
+	default:
+		return fmt.Errorf("unsupported YAML tag %s at line %d", node.ShortTag(), node.Line)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
@@ -0,0 +1,123 @@
+package testmongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSpec(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		spec, err := LoadSpec(os.DirFS("testdata"), "spec.yaml")
+		assert.NoError(t, err)
+		assert.Len(t, spec.Collections, 2)
+
+		orders := spec.Collections[0]
+		assert.Equal(t, "orders", orders.Name)
+		assert.Equal(t, "error", orders.ValidationAction)
+		assert.Equal(t, "$jsonSchema", orders.Validator[0].Key)
+		assert.Len(t, orders.Indexes, 3)
+		assert.Equal(t, bson.D{{Key: "customerId", Value: int32(1)}, {Key: "createdAt", Value: int32(-1)}}, orders.Indexes[0].Keys)
+		assert.EqualValues(t, 3600, *orders.Indexes[1].ExpireAfterSeconds)
+		assert.True(t, orders.Indexes[2].Unique)
+		assert.True(t, orders.Indexes[2].Sparse)
+	})
+	t.Run("json", func(t *testing.T) {
+		spec, err := ParseSpec([]byte(`{"collections": [{"name": "events", "indexes": [{"keys": {"at": 1}, "expireAfterSeconds": 60}]}]}`))
+		assert.NoError(t, err)
+		assert.Equal(t, "events", spec.Collections[0].Name)
+		assert.EqualValues(t, 60, *spec.Collections[0].Indexes[0].ExpireAfterSeconds)
+	})
+	t.Run("extended json in yaml", func(t *testing.T) {
+		spec, err := ParseSpec([]byte("collections:\n  - name: events\n    validator:\n      at: {$gte: {$date: \"2020-01-01T00:00:00Z\"}}\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"at":{"$gte":{"$date":"2020-01-01T00:00:00Z"}}}`, formatDocument(spec.Collections[0].Validator))
+	})
+	t.Run("missing name", func(t *testing.T) {
+		_, err := ParseSpec([]byte("collections:\n  - indexes: []\n"))
+		assert.Error(t, err)
+	})
+	t.Run("unknown keys", func(t *testing.T) {
+		_, err := ParseSpec([]byte("collections:\n  - name: events\n    indexes:\n      - keys: {at: 1}\n        expireAfterSecond: 60\n"))
+		assert.EqualError(t, err, `unknown key "expireAfterSecond" in index 0 of collection events`)
+
+		_, err = ParseSpec([]byte(`{"collections": [{"name": "events", "validationLevl": "strict"}]}`))
+		assert.EqualError(t, err, `unknown key "validationLevl" in collection events`)
+
+		_, err = ParseSpec([]byte(`{"collection": []}`))
+		assert.EqualError(t, err, `unknown key "collection" in spec`)
+	})
+	t.Run("missing keys", func(t *testing.T) {
+		_, err := ParseSpec([]byte("collections:\n  - name: events\n    indexes:\n      - unique: true\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	out, err := yamlToJSON([]byte("b: 1\na: [x, 2.5, true, null, '3']\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":1,"a":["x",2.5,true,null,"3"]}`, string(out))
+}
+
+func TestIndexSpecName(t *testing.T) {
+	assert.Equal(t, "a_1_b_-1", IndexSpec{Keys: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}}}.name())
+	assert.Equal(t, "body_text", IndexSpec{Keys: bson.D{{Key: "body", Value: "text"}}}.name())
+	assert.Equal(t, "custom", IndexSpec{Name: "custom", Keys: bson.D{{Key: "a", Value: int32(1)}}}.name())
+}
+
+func TestSameDocument(t *testing.T) {
+	assert.True(t, sameDocument(bson.D{{Key: "a", Value: int32(1)}}, bson.D{{Key: "a", Value: 1.0}}))
+	assert.True(t, sameDocument(bson.D(nil), bson.Raw(nil)))
+	assert.False(t, sameDocument(bson.D{{Key: "a", Value: int32(1)}}, bson.D{{Key: "a", Value: int32(-1)}}))
+}
+
+func TestSpec(t *testing.T) {
+	t.Parallel()
+	con, _ := RunTest(t)
+
+	spec, err := LoadSpec(os.DirFS("testdata"), "spec.yaml")
+	assert.NoError(t, err)
+
+	t.Run("applied on database creation", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.WithDatabaseSetup(spec.Apply).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		diffs, err := spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+
+		/// The validator rejects documents without the required fields.
+		_, err = db.Collection("orders").InsertOne(ctx, bson.D{{Key: "total", Value: 10}})
+		assert.Error(t, err)
+		_, err = db.Collection("orders").InsertOne(ctx, bson.D{{Key: "customerId", Value: "c1"}, {Key: "total", Value: 10}})
+		assert.NoError(t, err)
+	})
+	t.Run("apply is idempotent", func(t *testing.T) {
+		db, err := con.WithDatabaseSetup(spec.Apply, spec.Apply).NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		diffs, err := spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+	t.Run("reports differences", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := con.NewTestDatabase(t)
+		assert.NoError(t, err)
+
+		_, err = db.Collection("customers").InsertOne(ctx, bson.D{{Key: "email", Value: "a@example.com"}})
+		assert.NoError(t, err)
+		_, err = db.Collection("extra").InsertOne(ctx, bson.D{})
+		assert.NoError(t, err)
+
+		diffs, err := spec.Diff(db)
+		assert.NoError(t, err)
+		assert.Contains(t, diffs, "collection orders is missing")
+		assert.Contains(t, diffs, "index email_1 of collection customers is missing")
+		assert.Contains(t, diffs, "collection extra is not in the spec")
+	})
+}
@@ -0,0 +1,276 @@
+package testmongo
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	tlsDir            = "/etc/mongo-tls"
+	tlsServerFile     = tlsDir + "/server.pem"
+	tlsCAFile         = tlsDir + "/ca.pem"
+	tlsOrganization   = "testdeps"
+	tlsServerUnit     = "server"
+	tlsClientUnit     = "client"
+	tlsValidity       = time.Hour * 24
+	tlsCAFileName     = "ca.pem"
+	pemCertificate    = "CERTIFICATE"
+	pemPrivateKey     = "PRIVATE KEY"
+	serialNumberLimit = 128
+
+	// tlsScript writes the certificates generated by WithTLS to files mongod can read.
+	tlsScript = `if [ -n "$` + env_TESTDEPS_MONGO_TLS_CERT + `" ]; then ` +
+		`mkdir -p ` + tlsDir + ` && ` +
+		`printf '%s' "$` + env_TESTDEPS_MONGO_TLS_CERT + `" > ` + tlsServerFile + ` && ` +
+		`printf '%s' "$` + env_TESTDEPS_MONGO_TLS_CA + `" > ` + tlsCAFile + ` && ` +
+		`chown -R mongodb:mongodb ` + tlsDir + ` && chmod 400 ` + tlsServerFile + `; fi && `
+)
+
+// WithTLS starts mongod with `--tlsMode requireTLS`. A certificate authority and a server certificate for `localhost`
+// are generated when the Container starts. The key of the certificate authority never leaves the host.
+// The connection string of the Container enables TLS and trusts the certificate authority.
+// Clients may connect without a certificate. Use NewClientCertificate or NewX509User to issue client certificates.
+// Requires mongo 4.2 or later.
+func WithTLS() options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if request.Env == nil {
+			request.Env = make(map[string]string)
+		}
+		request.Env[env_TESTDEPS_MONGO_TLS] = "true"
+		request.Entrypoint = []string{"bash", "-c", entrypoint, "--"}
+		request.Cmd = append(request.Cmd,
+			"--tlsMode", "requireTLS",
+			"--tlsCertificateKeyFile", tlsServerFile,
+			"--tlsCAFile", tlsCAFile,
+			"--tlsAllowConnectionsWithoutCertificates",
+		)
+		return nil
+	}
+}
+
+// ClientCertificate is a client certificate issued by the certificate authority of a Container started with WithTLS.
+type ClientCertificate struct {
+	// Subject is the distinguished name of the certificate, e.g., `CN=app,OU=client,O=testdeps`.
+	// It is also the name of the certificate's x.509 user.
+	Subject string
+	// CertificateKeyFile is the path of a PEM file containing the certificate and its private key.
+	CertificateKeyFile string
+	// CAFile is the path of a PEM file containing the certificate authority.
+	CAFile string
+}
+
+// TLSConfig returns a tls.Config that presents the ClientCertificate and trusts the certificate authority.
+func (cc *ClientCertificate) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cc.CertificateKeyFile, cc.CertificateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, err := os.ReadFile(cc.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificate authority found in " + cc.CAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// NewClientCertificate issues a client certificate with the given common name.
+// The Container must be started with WithTLS. The files are removed when the Container is terminated.
+func (c *Container) NewClientCertificate(commonName string) (*ClientCertificate, error) {
+	if c.tls == nil {
+		return nil, errors.New("client certificates require a Container started with WithTLS")
+	}
+
+	subject := pkix.Name{
+		CommonName:         commonName,
+		Organization:       []string{tlsOrganization},
+		OrganizationalUnit: []string{tlsClientUnit},
+	}
+	cert, key, err := c.tls.ca.issue(subject, false)
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(c.tls.dir, common.GenerateId()+".pem")
+	if err := os.WriteFile(file, append(cert, key...), 0600); err != nil {
+		return nil, err
+	}
+
+	return &ClientCertificate{
+		Subject:            subject.String(),
+		CertificateKeyFile: file,
+		CAFile:             c.tls.caFile,
+	}, nil
+}
+
+// containerTLS holds the certificate authority of a Container started with WithTLS and the host directory of its files.
+type containerTLS struct {
+	ca     *certificateAuthority
+	dir    string
+	caFile string
+}
+
+// newContainerTLS generates the certificate authority and the server certificate of cReq and writes the certificate
+// of the authority to a temporary directory. Only the certificates and the server key are added to the environment of
+// cReq, the key of the authority is kept in memory to issue client certificates.
+// It returns nil if cReq does not use TLS.
+func newContainerTLS(cReq *tc.ContainerRequest) (*containerTLS, error) {
+	if !tlsEnabled(*cReq) {
+		return nil, nil
+	}
+
+	ca, err := newCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert, serverKey, err := ca.issue(pkix.Name{
+		CommonName:         "localhost",
+		Organization:       []string{tlsOrganization},
+		OrganizationalUnit: []string{tlsServerUnit},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "testmongo-tls-")
+	if err != nil {
+		return nil, err
+	}
+
+	caFile := filepath.Join(dir, tlsCAFileName)
+	if err := os.WriteFile(caFile, ca.certPEM, 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	cReq.Env[env_TESTDEPS_MONGO_TLS_CA] = string(ca.certPEM)
+	cReq.Env[env_TESTDEPS_MONGO_TLS_CERT] = string(serverCert) + string(serverKey)
+
+	return &containerTLS{ca: ca, dir: dir, caFile: caFile}, nil
+}
+
+// tlsEnabled reports whether cReq was configured by WithTLS.
+func tlsEnabled(cReq tc.ContainerRequest) bool {
+	_, exists := cReq.Env[env_TESTDEPS_MONGO_TLS]
+	return exists
+}
+
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+func newCertificateAuthority() (*certificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "testdeps CA", Organization: []string{tlsOrganization}},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(tlsValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificateAuthority{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: pemCertificate, Bytes: der}),
+		key:     key,
+	}, nil
+}
+
+// issue creates a certificate for subject signed by the certificate authority and returns it and its key as PEM.
+// Server certificates are valid for localhost and may also be used as client certificates.
+func (ca *certificateAuthority) issue(subject pkix.Name, server bool) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(tlsValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return
+	}
+
+	keyPEM, err = encodePrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemCertificate, Bytes: der}), keyPEM, nil
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateKey, Bytes: der}), nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberLimit))
+}
@@ -0,0 +1,368 @@
+package testmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	queryAuthSource            = "authSource"
+	queryAuthMechanism         = "authMechanism"
+	queryTLSCertificateKeyFile = "tlsCertificateKeyFile"
+	queryTLSCAFile             = "tlsCAFile"
+	externalDatabase           = "$external"
+	authMechanismX509          = "MONGODB-X509"
+)
+
+// User is a database user created within the Container.
+type User struct {
+	Name     string
+	Password string
+	// Database is the database the User was created in and authenticates against, `$external` for x.509 users.
+	Database         string
+	ConnectionString string
+	// Certificate is the client certificate of an x.509 user.
+	Certificate *ClientCertificate
+
+	roleDatabase string
+	customRoles  []string
+}
+
+// Privilege allows a set of actions, e.g., "find" or "insert", on a collection of the User's database.
+// An empty Collection applies the privilege to every collection of the database.
+type Privilege struct {
+	Collection string
+	Actions    []string
+}
+
+// UserOption customizes a User before it is created.
+type UserOption func(*userConfig) error
+
+type userConfig struct {
+	roles       []roleRef
+	customRoles []customRole
+}
+
+// roleRef refers to a role of database, or of the User's role database if database is empty.
+type roleRef struct {
+	role     string
+	database string
+}
+
+type customRole struct {
+	name       string
+	privileges []Privilege
+}
+
+// WithRoles grants the given roles of the User's database to the User, e.g., the built-in "read" or "readWrite" roles.
+func WithRoles(roles ...string) UserOption {
+	return func(cfg *userConfig) error {
+		for _, role := range roles {
+			cfg.roles = append(cfg.roles, roleRef{role: role})
+		}
+		return nil
+	}
+}
+
+// WithRolesOn grants the given roles of another database to the User, e.g., WithRolesOn("admin", "clusterMonitor").
+func WithRolesOn(database string, roles ...string) UserOption {
+	return func(cfg *userConfig) error {
+		if database == "" {
+			return errors.New("role database must not be empty")
+		}
+		for _, role := range roles {
+			cfg.roles = append(cfg.roles, roleRef{role: role, database: database})
+		}
+		return nil
+	}
+}
+
+// WithCustomRole creates a role with the given name and privileges in the User's database and grants it to the User.
+// Custom roles created by NewTestUser are dropped along with the User.
+func WithCustomRole(name string, privileges ...Privilege) UserOption {
+	return func(cfg *userConfig) error {
+		if name == "" {
+			return errors.New("custom role name must not be empty")
+		}
+		if len(privileges) == 0 {
+			return fmt.Errorf("custom role %s has no privileges", name)
+		}
+		cfg.customRoles = append(cfg.customRoles, customRole{name: name, privileges: privileges})
+		cfg.roles = append(cfg.roles, roleRef{role: name})
+		return nil
+	}
+}
+
+// NewUser creates a user with the given name and options in database.
+// The Container must be started with WithRootUser, otherwise authorization is not enforced.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewUser(database, name string, opts ...UserOption) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewUserWithContext(ctx, database, name, opts...)
+}
+
+// NewUserWithContext creates a user with the given name and options in database.
+// The Container must be started with WithRootUser, otherwise authorization is not enforced.
+// NewUserWithContext exists to allow you to customize the connection process, e.g., apply timeout.
+func (c *Container) NewUserWithContext(ctx context.Context, database, name string, opts ...UserOption) (*User, error) {
+	password := common.GenerateId()
+	connStr, err := makeUserConnectionString(c.ConnectionString, name, password, database)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Name:             name,
+		Password:         password,
+		Database:         database,
+		ConnectionString: connStr,
+		roleDatabase:     database,
+	}
+	if err := c.createUser(ctx, user, opts); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// NewX509User issues a client certificate with the given common name and creates an x.509 user for it.
+// Roles granted with WithRoles and WithCustomRole refer to database. The User's ConnectionString authenticates with its certificate.
+// The Container must be started with WithTLS and WithRootUser, otherwise authorization is not enforced.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewX509User(commonName, database string, opts ...UserOption) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewX509UserWithContext(ctx, commonName, database, opts...)
+}
+
+// NewX509UserWithContext issues a client certificate with the given common name and creates an x.509 user for it.
+// Roles granted with WithRoles and WithCustomRole refer to database. The User's ConnectionString authenticates with its certificate.
+// The Container must be started with WithTLS and WithRootUser, otherwise authorization is not enforced.
+func (c *Container) NewX509UserWithContext(ctx context.Context, commonName, database string, opts ...UserOption) (*User, error) {
+	cert, err := c.NewClientCertificate(commonName)
+	if err != nil {
+		return nil, err
+	}
+
+	connStr, err := makeX509ConnectionString(c.ConnectionString, cert.CertificateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Name:             cert.Subject,
+		Database:         externalDatabase,
+		ConnectionString: connStr,
+		Certificate:      cert,
+		roleDatabase:     database,
+	}
+	if err := c.createUser(ctx, user, opts); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// NewTestUser creates a user with a random name in database.
+// The user and its custom roles are automatically dropped after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewTestUser(t testing.TB, database string, opts ...UserOption) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewTestUserWithContext(t, ctx, database, opts...)
+}
+
+// NewTestUserWithContext creates a user with a random name in database.
+// The user and its custom roles are automatically dropped after the test finishes.
+func (c *Container) NewTestUserWithContext(t testing.TB, ctx context.Context, database string, opts ...UserOption) (*User, error) {
+	user, err := c.NewUserWithContext(ctx, database, randomUserName(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dropUserOnCleanup(t, user)
+	return user, nil
+}
+
+// NewTestX509User creates an x.509 user whose certificate has a random common name.
+// The user and its custom roles are automatically dropped after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewTestX509User(t testing.TB, database string, opts ...UserOption) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewTestX509UserWithContext(t, ctx, database, opts...)
+}
+
+// NewTestX509UserWithContext creates an x.509 user whose certificate has a random common name.
+// The user and its custom roles are automatically dropped after the test finishes.
+func (c *Container) NewTestX509UserWithContext(t testing.TB, ctx context.Context, database string, opts ...UserOption) (*User, error) {
+	user, err := c.NewX509UserWithContext(ctx, randomUserName(), database, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dropUserOnCleanup(t, user)
+	return user, nil
+}
+
+// AsUser returns a copy of the Container that connects as the given User.
+// Every helper of the copy, e.g., NewTestClient, uses the User's connection string.
+func (c *Container) AsUser(user *User) *Container {
+	con := *c
+	con.ConnectionString = user.ConnectionString
+	con.shared = &sharedClient{}
+	return &con
+}
+
+// createUser creates the custom roles of opts in the role database of user, then user itself.
+func (c *Container) createUser(ctx context.Context, user *User, opts []UserOption) error {
+	cfg := userConfig{}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return err
+		}
+	}
+
+	client, err := c.NewClientWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	roleDB := client.Database(user.roleDatabase)
+	for _, role := range cfg.customRoles {
+		if err := roleDB.RunCommand(ctx, role.command(user.roleDatabase)).Err(); err != nil {
+			_ = user.drop(ctx, client)
+			return fmt.Errorf("creating role %s: %w", role.name, err)
+		}
+		user.customRoles = append(user.customRoles, role.name)
+	}
+
+	roles := bson.A{}
+	for _, ref := range cfg.roles {
+		database := ref.database
+		if database == "" {
+			database = user.roleDatabase
+		}
+		roles = append(roles, bson.D{{Key: "role", Value: ref.role}, {Key: "db", Value: database}})
+	}
+
+	cmd := bson.D{{Key: "createUser", Value: user.Name}}
+	if user.Password != "" {
+		cmd = append(cmd, bson.E{Key: "pwd", Value: user.Password})
+	}
+	cmd = append(cmd, bson.E{Key: "roles", Value: roles})
+
+	if err := client.Database(user.Database).RunCommand(ctx, cmd).Err(); err != nil {
+		_ = user.drop(ctx, client)
+		return err
+	}
+	return nil
+}
+
+// dropUserOnCleanup drops user and its custom roles after the test finishes.
+func (c *Container) dropUserOnCleanup(t testing.TB, user *User) {
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+
+		client, err := c.NewClientWithContext(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer client.Disconnect(ctx)
+
+		if err := user.drop(ctx, client); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// drop drops the User, if it was created, and its custom roles.
+func (u *User) drop(ctx context.Context, client *mongo.Client) error {
+	err := client.Database(u.Database).RunCommand(ctx, bson.D{{Key: "dropUser", Value: u.Name}}).Err()
+	var cmdErr mongo.CommandError
+	/// The user does not exist when creating it failed.
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Name == "UserNotFound") {
+		return err
+	}
+
+	for _, role := range u.customRoles {
+		if err := client.Database(u.roleDatabase).RunCommand(ctx, bson.D{{Key: "dropRole", Value: role}}).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func randomUserName() string {
+	return "user_" + strings.ToLower(common.GenerateId())
+}
+
+func (r customRole) command(database string) bson.D {
+	privileges := bson.A{}
+	for _, privilege := range r.privileges {
+		privileges = append(privileges, bson.D{
+			{Key: "resource", Value: bson.D{{Key: "db", Value: database}, {Key: "collection", Value: privilege.Collection}}},
+			{Key: "actions", Value: privilege.Actions},
+		})
+	}
+
+	return bson.D{
+		{Key: "createRole", Value: r.name},
+		{Key: "privileges", Value: privileges},
+		{Key: "roles", Value: bson.A{}},
+	}
+}
+
+// makeUserConnectionString replaces the credentials of connStr with those of a user that authenticates against database.
+func makeUserConnectionString(connStr, name, password, database string) (string, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", err
+	}
+	if u.User == nil {
+		return "", errors.New("users require a Container started with WithRootUser, otherwise authorization is not enforced")
+	}
+
+	u.User = url.UserPassword(name, password)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	query := u.Query()
+	query.Set(queryAuthSource, database)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// makeX509ConnectionString replaces the credentials of connStr with the x.509 client certificate in certificateKeyFile.
+func makeX509ConnectionString(connStr, certificateKeyFile string) (string, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", err
+	}
+	if u.User == nil {
+		return "", errors.New("users require a Container started with WithRootUser, otherwise authorization is not enforced")
+	}
+
+	u.User = nil
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	query := u.Query()
+	query.Set(queryAuthMechanism, authMechanismX509)
+	query.Set(queryAuthSource, externalDatabase)
+	query.Set(queryTLSCertificateKeyFile, certificateKeyFile)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
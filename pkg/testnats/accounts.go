@@ -0,0 +1,377 @@
+package testnats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	claimsUpdateSubject  = "$SYS.REQ.CLAIMS.UPDATE"
+	claimsDeleteSubject  = "$SYS.REQ.CLAIMS.DELETE"
+	claimsDeleteAccounts = "accounts"
+	resolverDir          = "jwt"
+	operatorName         = "testdeps"
+	systemAccountName    = "SYS"
+	defaultAccountName   = "default"
+	unlimited            = -1
+)
+
+// WithAccounts runs the NATS server in operator mode, so every test gets its own account.
+// A configuration file with an operator, a system account and an account resolver is generated when the Container starts.
+//
+// NewTestConnection, and the helpers built on it such as NewTestJetStream, connect with a fresh account per test,
+// which fully isolates the subjects and JetStream assets of tests sharing the Container. The account and its streams
+// are deleted after the test finishes. Use NewTestAccount to share an account between several tests.
+// NewConnection, and everything that uses it such as WithSpec, connects with a default account.
+func WithAccounts() options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if request.Env == nil {
+			request.Env = make(map[string]string)
+		}
+		request.Env[env_TESTDEPS_NATS_ACCOUNTS] = "true"
+		return nil
+	}
+}
+
+// Account is an account of a Container started with WithAccounts along with a user to connect with.
+type Account struct {
+	// Name is the name of the account.
+	Name string
+	// PublicKey is the public key that identifies the account.
+	PublicKey string
+
+	container *Container
+	user      *user
+}
+
+// NewConnection creates a NATS connection to the underlying docker Container as a user of the Account.
+// A default context is used with a timeout of two minutes. To customize use NewConnectionWithContext.
+func (a *Account) NewConnection(options ...nats.Option) (*nats.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return a.NewConnectionWithContext(ctx, options...)
+}
+
+// NewConnectionWithContext creates a NATS connection to the underlying docker Container as a user of the Account.
+func (a *Account) NewConnectionWithContext(ctx context.Context, options ...nats.Option) (*nats.Conn, error) {
+	return a.container.connect(ctx, append([]nats.Option{a.user.option()}, options...))
+}
+
+// Credentials returns a credentials file for a user of the Account, e.g., to pass to nats.UserCredentials.
+func (a *Account) Credentials() ([]byte, error) {
+	return a.user.credentials()
+}
+
+// NewTestAccount creates an account in a Container started with WithAccounts.
+// The account and its streams are deleted after t is finished.
+// A default context is used with a timeout of two minutes. To customize use NewTestAccountWithContext.
+func (c *Container) NewTestAccount(t *testing.T) (*Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return c.NewTestAccountWithContext(t, ctx)
+}
+
+// NewTestAccountWithContext creates an account in a Container started with WithAccounts.
+// The account and its streams are deleted after t is finished.
+func (c *Container) NewTestAccountWithContext(t *testing.T, ctx context.Context) (*Account, error) {
+	if c.operator == nil {
+		return nil, errors.New("accounts require a Container started with WithAccounts")
+	}
+
+	name := strings.ToLower(t.Name())
+	key, accountJWT, err := c.operator.newAccount(name)
+	if err != nil {
+		return nil, err
+	}
+	user, err := newUser(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.updateClaims(ctx, claimsUpdateSubject, accountJWT); err != nil {
+		return nil, err
+	}
+
+	publicKey, _ := key.PublicKey()
+	account := &Account{
+		Name:      name,
+		PublicKey: publicKey,
+		container: c,
+		user:      user,
+	}
+
+	t.Cleanup(func() {
+		if err := account.delete(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return account, nil
+}
+
+// testAccount returns the account of t, creating it on first use.
+// The lock only guards the lookup, so tests creating their accounts do not wait for each other.
+func (c *Container) testAccount(t *testing.T, ctx context.Context) (*Account, error) {
+	c.testAccounts.mu.Lock()
+	entry, exists := c.testAccounts.byTest[t]
+	if !exists {
+		if c.testAccounts.byTest == nil {
+			c.testAccounts.byTest = make(map[*testing.T]*testAccountEntry)
+		}
+		entry = &testAccountEntry{}
+		c.testAccounts.byTest[t] = entry
+		t.Cleanup(func() {
+			c.testAccounts.mu.Lock()
+			defer c.testAccounts.mu.Unlock()
+			delete(c.testAccounts.byTest, t)
+		})
+	}
+	c.testAccounts.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.account, entry.err = c.NewTestAccountWithContext(t, ctx)
+	})
+	return entry.account, entry.err
+}
+
+// delete deletes the streams of the account, then the account itself.
+func (a *Account) delete() error {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	if a.container.jetStreamEnabled() {
+		err := a.container.withConnection(ctx, a.user.option(), func(conn *nats.Conn) error {
+			js, err := conn.JetStream(nats.Context(ctx))
+			if err != nil {
+				return err
+			}
+			for stream := range js.StreamNames() {
+				if err := js.DeleteStream(stream); err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+					return fmt.Errorf("deleting stream %s of account %s: %w", stream, a.Name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	deleteJWT, err := a.container.operator.deleteAccounts(a.PublicKey)
+	if err != nil {
+		return err
+	}
+	return a.container.updateClaims(ctx, claimsDeleteSubject, deleteJWT)
+}
+
+// updateClaims sends the claims request token to subject as the system account and fails unless the server accepts it.
+func (c *Container) updateClaims(ctx context.Context, subject, token string) error {
+	return c.withConnection(ctx, c.operator.systemUser.option(), func(conn *nats.Conn) error {
+		msg, err := conn.RequestWithContext(ctx, subject, []byte(token))
+		if err != nil {
+			return err
+		}
+
+		var response struct {
+			Error *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			return err
+		}
+		if response.Error != nil {
+			return errors.New(response.Error.Description)
+		}
+		return nil
+	})
+}
+
+// withConnection calls fn with a new connection authenticated by auth that is closed afterwards.
+func (c *Container) withConnection(ctx context.Context, auth nats.Option, fn func(conn *nats.Conn) error) error {
+	conn, err := c.connect(ctx, []nats.Option{auth})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+// jetStreamEnabled reports whether the server has JetStream enabled.
+func (c *Container) jetStreamEnabled() bool {
+	if c.server != nil {
+		return c.server.JetStreamEnabled()
+	}
+	return jetStreamEnabled(c.req)
+}
+
+// testAccounts tracks the accounts NewTestConnection creates per test.
+type testAccounts struct {
+	mu     sync.Mutex
+	byTest map[*testing.T]*testAccountEntry
+}
+
+// testAccountEntry is the account of a single test, which is created once.
+type testAccountEntry struct {
+	once    sync.Once
+	account *Account
+	err     error
+}
+
+// operator is the operator of a Container started with WithAccounts.
+type operator struct {
+	key              nkeys.KeyPair
+	jwt              string
+	systemAccountJWT string
+	systemUser       *user
+	defaultJWT       string
+	defaultUser      *user
+}
+
+// newOperator generates an operator with a system account and a default account.
+func newOperator() (*operator, error) {
+	key, err := nkeys.CreateOperator()
+	if err != nil {
+		return nil, err
+	}
+	op := &operator{key: key}
+
+	systemKey, systemJWT, err := op.newAccount(systemAccountName)
+	if err != nil {
+		return nil, err
+	}
+	op.systemAccountJWT = systemJWT
+	if op.systemUser, err = newUser(systemKey); err != nil {
+		return nil, err
+	}
+
+	defaultKey, defaultJWT, err := op.newAccount(defaultAccountName)
+	if err != nil {
+		return nil, err
+	}
+	op.defaultJWT = defaultJWT
+	if op.defaultUser, err = newUser(defaultKey); err != nil {
+		return nil, err
+	}
+
+	publicKey, _ := key.PublicKey()
+	claims := jwt.NewOperatorClaims(publicKey)
+	claims.Name = operatorName
+	claims.SystemAccount, _ = systemKey.PublicKey()
+	if op.jwt, err = claims.Encode(key); err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+// newAccount generates an account signed by the operator. Accounts other than the system account may use JetStream without limits.
+func (o *operator) newAccount(name string) (nkeys.KeyPair, string, error) {
+	key, err := nkeys.CreateAccount()
+	if err != nil {
+		return nil, "", err
+	}
+
+	publicKey, _ := key.PublicKey()
+	claims := jwt.NewAccountClaims(publicKey)
+	claims.Name = name
+	if name != systemAccountName {
+		claims.Limits.JetStreamLimits = jwt.JetStreamLimits{
+			MemoryStorage: unlimited,
+			DiskStorage:   unlimited,
+			Streams:       unlimited,
+			Consumer:      unlimited,
+		}
+	}
+
+	token, err := claims.Encode(o.key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// deleteAccounts returns a request token to delete the accounts with the given public keys.
+func (o *operator) deleteAccounts(publicKeys ...string) (string, error) {
+	publicKey, _ := o.key.PublicKey()
+	claims := jwt.NewGenericClaims(publicKey)
+	claims.Data[claimsDeleteAccounts] = publicKeys
+	return claims.Encode(o.key)
+}
+
+// config returns the server configuration of the operator. Account JWTs are stored below dataDir.
+func (o *operator) config(dataDir string) string {
+	systemPublicKey, _ := o.systemUser.account.PublicKey()
+	defaultPublicKey, _ := o.defaultUser.account.PublicKey()
+
+	return fmt.Sprintf(`operator: %s
+system_account: %s
+resolver: {
+  type: full
+  dir: %s
+  allow_delete: true
+}
+resolver_preload: {
+  %s: %s
+  %s: %s
+}
+`,
+		quoteConfig(o.jwt),
+		systemPublicKey,
+		quoteConfig(path.Join(dataDir, resolverDir)),
+		systemPublicKey, quoteConfig(o.systemAccountJWT),
+		defaultPublicKey, quoteConfig(o.defaultJWT),
+	)
+}
+
+// user is a user of an account.
+type user struct {
+	account nkeys.KeyPair
+	key     nkeys.KeyPair
+	jwt     string
+}
+
+// newUser generates a user of account without restrictions.
+func newUser(account nkeys.KeyPair) (*user, error) {
+	key, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, _ := key.PublicKey()
+	token, err := jwt.NewUserClaims(publicKey).Encode(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user{account: account, key: key, jwt: token}, nil
+}
+
+// option authenticates a connection as the user.
+func (u *user) option() nats.Option {
+	return nats.UserJWT(
+		func() (string, error) { return u.jwt, nil },
+		func(nonce []byte) ([]byte, error) { return u.key.Sign(nonce) },
+	)
+}
+
+// credentials returns a credentials file for the user.
+func (u *user) credentials() ([]byte, error) {
+	seed, err := u.key.Seed()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.FormatUserConfig(u.jwt, seed)
+}
@@ -0,0 +1,181 @@
+package testnats
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+func TestWithAccounts(t *testing.T) {
+	cReq := tc.ContainerRequest{}
+	assert.NoError(t, WithAccounts()(&cReq))
+
+	setup, err := takeRunSetup(&cReq, "/data")
+	assert.NoError(t, err)
+	assert.NotNil(t, setup.operator)
+	assert.Contains(t, setup.config, "operator: ")
+	assert.Contains(t, setup.config, `dir: "/data/jwt"`)
+	assert.Empty(t, cReq.Env, "setup is not passed on to the server")
+}
+
+func TestContainer_NewTestAccount(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithJetStream(), WithAccounts())
+	assert.NoError(t, err)
+
+	t.Run("default account", func(t *testing.T) {
+		conn, err := con.NewConnection()
+		assert.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, nats.CONNECTED, conn.Status())
+
+		_, err = nats.Connect(con.ConnectionString)
+		assert.Error(t, err, "connections without credentials are rejected")
+	})
+
+	var streams nats.JetStreamContext
+	t.Run("isolates tests", func(t *testing.T) {
+		a, err := con.NewTestAccount(t)
+		assert.NoError(t, err)
+		b, err := con.NewTestAccount(t)
+		assert.NoError(t, err)
+		assert.NotEqual(t, a.PublicKey, b.PublicKey)
+
+		connA, err := a.NewConnection()
+		assert.NoError(t, err)
+		defer connA.Close()
+		connB, err := b.NewConnection()
+		assert.NoError(t, err)
+		defer connB.Close()
+
+		subB, err := connB.SubscribeSync("orders.created")
+		assert.NoError(t, err)
+		assert.NoError(t, connA.Publish("orders.created", []byte("a")))
+		assert.NoError(t, connA.Flush())
+		_, err = subB.NextMsg(time.Millisecond * 100)
+		assert.ErrorIs(t, err, nats.ErrTimeout)
+
+		jsA, err := connA.JetStream()
+		assert.NoError(t, err)
+		_, err = jsA.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		assert.NoError(t, err)
+
+		jsB, err := connB.JetStream()
+		assert.NoError(t, err)
+		_, err = jsB.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		assert.NoError(t, err, "stream names do not collide")
+
+		streams, err = con.NewTestJetStream(t)
+		assert.NoError(t, err)
+	})
+
+	_, err = streams.StreamInfo("ORDERS")
+	assert.Error(t, err, "accounts are deleted after the test")
+}
+
+func TestContainer_NewTestConnection_WithAccounts(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithJetStream(), WithAccounts())
+	assert.NoError(t, err)
+
+	var accountOfTest *Account
+	t.Run("subtest", func(t *testing.T) {
+		first, err := con.NewTestConnection(t)
+		assert.NoError(t, err)
+		second, err := con.NewTestConnection(t)
+		assert.NoError(t, err)
+
+		sub, err := second.SubscribeSync("greetings")
+		assert.NoError(t, err)
+		assert.NoError(t, second.Flush())
+		assert.NoError(t, first.Publish("greetings", []byte("hello")))
+		_, err = sub.NextMsg(time.Second)
+		assert.NoError(t, err, "connections of a test share its account")
+
+		other, err := con.NewConnection()
+		assert.NoError(t, err)
+		defer other.Close()
+		otherSub, err := other.SubscribeSync("greetings")
+		assert.NoError(t, err)
+		assert.NoError(t, other.Flush())
+		assert.NoError(t, first.Publish("greetings", []byte("hello")))
+		_, err = otherSub.NextMsg(time.Millisecond * 100)
+		assert.ErrorIs(t, err, nats.ErrTimeout, "the default account is isolated from the test")
+
+		entry := con.testAccounts.byTest[t]
+		if assert.NotNil(t, entry) {
+			accountOfTest = entry.account
+		}
+		assert.NotNil(t, accountOfTest)
+	})
+
+	assert.Empty(t, con.testAccounts.byTest)
+	_, err = accountOfTest.NewConnection(nats.NoReconnect())
+	assert.Error(t, err, "account is deleted after the test")
+}
+
+func TestContainer_testAccount_Concurrent(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithAccounts())
+	assert.NoError(t, err)
+
+	accounts := make([]*Account, 4)
+	var wg sync.WaitGroup
+	for i := range accounts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			accounts[i], _ = con.testAccount(t, context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, account := range accounts {
+		assert.NotNil(t, account)
+		assert.Same(t, accounts[0], account, "connections of a test share its account")
+	}
+}
+
+func TestAccount_Credentials(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithAccounts())
+	assert.NoError(t, err)
+
+	account, err := con.NewTestAccount(t)
+	assert.NoError(t, err)
+
+	creds, err := account.Credentials()
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "user.creds")
+	assert.NoError(t, os.WriteFile(path, creds, 0600))
+
+	conn, err := nats.Connect(con.ConnectionString, nats.UserCredentials(path))
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestContainer_NewTestAccount_WithoutAccounts(t *testing.T) {
+	con, err := RunEmbeddedTest(t)
+	assert.NoError(t, err)
+
+	_, err = con.NewTestAccount(t)
+	assert.Error(t, err)
+}
+
+func TestRun_WithAccounts(t *testing.T) {
+	t.Parallel()
+	con, err := RunTest(t, WithJetStream(), WithAccounts())
+	assert.NoError(t, err)
+
+	js, err := con.NewTestJetStream(t)
+	assert.NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "ORDERS"})
+	assert.NoError(t, err)
+
+	_, err = nats.Connect(con.ConnectionString)
+	assert.Error(t, err, "connections without credentials are rejected")
+}
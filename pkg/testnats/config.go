@@ -0,0 +1,102 @@
+package testnats
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	configFileName      = "testdeps-nats.conf"
+	containerConfigFile = "/" + configFileName
+	containerDataDir    = "/data"
+	cmdConfig           = "--config"
+	configFileMode      = 0644
+)
+
+// WithConfig starts the NATS server with a configuration file with the given contents, see
+// https://docs.nats.io/running-a-nats-service/configuration. WithConfig may be given several times, the
+// contents are concatenated in order. Command line arguments, such as the one of WithJetStream, take precedence.
+func WithConfig(config string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		if request.Env == nil {
+			request.Env = make(map[string]string)
+		}
+		request.Env[env_TESTDEPS_NATS_CONFIG] += config + "\n"
+		return nil
+	}
+}
+
+// runSetup is what the options of a request set up beyond the container itself.
+type runSetup struct {
+	config   string
+	operator *operator
+	spec     *Spec
+}
+
+// takeRunSetup removes the setup of the testnats options from the environment of request, so it is not passed on to
+// the server, and generates the configuration file. dataDir is the directory the server may write its data to.
+func takeRunSetup(request *tc.ContainerRequest, dataDir string) (setup runSetup, err error) {
+	setup.config = takeEnv(request, env_TESTDEPS_NATS_CONFIG)
+
+	if takeEnv(request, env_TESTDEPS_NATS_ACCOUNTS) != "" {
+		if setup.operator, err = newOperator(); err != nil {
+			return
+		}
+		setup.config += setup.operator.config(dataDir)
+	}
+
+	if spec := takeEnv(request, env_TESTDEPS_NATS_SPEC); spec != "" {
+		if setup.spec, err = ParseSpec([]byte(spec)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// start finishes setting up the running Container.
+func (s runSetup) start(ctx context.Context, c *Container) error {
+	c.operator = s.operator
+	if s.spec == nil {
+		return nil
+	}
+	return c.ApplySpecWithContext(ctx, s.spec)
+}
+
+// copyConfig copies the configuration file into the created, but not yet started, docker Container.
+func (s runSetup) copyConfig(ctx context.Context, c tc.Container) error {
+	dir, err := os.MkdirTemp("", "testnats")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := s.writeConfig(dir)
+	if err != nil {
+		return err
+	}
+	return c.CopyFileToContainer(ctx, path, containerConfigFile, configFileMode)
+}
+
+// writeConfig writes the configuration file into dir and returns its path.
+func (s runSetup) writeConfig(dir string) (string, error) {
+	path := filepath.Join(dir, configFileName)
+	return path, os.WriteFile(path, []byte(s.config), configFileMode)
+}
+
+// takeEnv removes key from the environment of request and returns its value.
+func takeEnv(request *tc.ContainerRequest, key string) string {
+	value := request.Env[key]
+	delete(request.Env, key)
+	return value
+}
+
+// quoteConfig quotes s as a string of a NATS configuration file.
+func quoteConfig(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,40 @@
+package testnats
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+func TestWithConfig(t *testing.T) {
+	t.Run("concatenates configs", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithConfig("max_payload: 1024")(&cReq))
+		assert.NoError(t, WithConfig("max_connections: 10")(&cReq))
+
+		setup, err := takeRunSetup(&cReq, "/data")
+		assert.NoError(t, err)
+		assert.Equal(t, "max_payload: 1024\nmax_connections: 10\n", setup.config)
+		assert.Empty(t, cReq.Env)
+	})
+	t.Run("configures server", func(t *testing.T) {
+		con, err := RunEmbeddedTest(t, WithConfig("max_payload: 1024"))
+		assert.NoError(t, err)
+
+		conn, err := con.NewTestConnection(t)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1024, conn.MaxPayload())
+		assert.ErrorIs(t, conn.Publish("big", make([]byte, 2048)), nats.ErrMaxPayload)
+	})
+	t.Run("forwards invalid config", func(t *testing.T) {
+		con, err := RunEmbedded(WithConfig("max_payload: {"))
+		assert.Error(t, err)
+		assert.Nil(t, con)
+	})
+}
+
+func TestQuoteConfig(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c"`, quoteConfig(`a"b\c`))
+}
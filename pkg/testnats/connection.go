@@ -17,7 +17,16 @@ func (c *Container) NewConnection(options ...nats.Option) (*nats.Conn, error) {
 }
 
 // NewConnectionWithContext creates a NATS connection to the underlying docker Container.
+// If the Container was started with WithAccounts the connection uses the default account.
 func (c *Container) NewConnectionWithContext(ctx context.Context, options ...nats.Option) (*nats.Conn, error) {
+	if c.operator != nil {
+		options = append([]nats.Option{c.operator.defaultUser.option()}, options...)
+	}
+	return c.connect(ctx, options)
+}
+
+// connect creates a NATS connection with the given options, giving up once ctx is done.
+func (c *Container) connect(ctx context.Context, options []nats.Option) (*nats.Conn, error) {
 	connChan := make(chan *nats.Conn, 1)
 	errChan := make(chan error, 1)
 
@@ -52,8 +61,18 @@ func (c *Container) NewTestConnection(t *testing.T, options ...nats.Option) (*na
 
 // NewTestConnectionWithContext creates a NATS connection to the underlying docker Container.
 // The connection is automatically closed after t is finished.
+// If the Container was started with WithAccounts the connection uses an account of its own for t.
 func (c *Container) NewTestConnectionWithContext(t *testing.T, ctx context.Context, options ...nats.Option) (*nats.Conn, error) {
-	conn, err := c.NewConnectionWithContext(ctx, options...)
+	newConnection := c.NewConnectionWithContext
+	if c.operator != nil {
+		account, err := c.testAccount(t, ctx)
+		if err != nil {
+			return nil, err
+		}
+		newConnection = account.NewConnectionWithContext
+	}
+
+	conn, err := newConnection(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
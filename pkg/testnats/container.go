@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/kyleishie/testdeps/pkg/options"
+	natsserver "github.com/nats-io/nats-server/v2/server"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
@@ -23,6 +24,10 @@ type Container struct {
 	tc.Container
 	req              tc.ContainerRequest
 	ConnectionString string
+	server           *natsserver.Server
+	tempStoreDir     string
+	operator         *operator
+	testAccounts     testAccounts
 }
 
 // Run creates and starts a docker Container with the `nats/nats` image.
@@ -55,13 +60,37 @@ func RunWithContext(ctx context.Context, options ...options.Option) (con *Contai
 		}
 	}
 
+	setup, err := takeRunSetup(&cReq, containerDataDir)
+	if err != nil {
+		return
+	}
+	if setup.config != "" {
+		cReq.Cmd = append(cReq.Cmd, cmdConfig, containerConfigFile)
+	}
+
+	/// The configuration file is copied into the container before it is started.
 	c, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
 		ContainerRequest: cReq,
-		Started:          true,
+		Started:          setup.config == "",
 	})
 	if err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			_ = c.Terminate(ctx)
+			con = nil
+		}
+	}()
+
+	if setup.config != "" {
+		if err = setup.copyConfig(ctx, c); err != nil {
+			return
+		}
+		if err = c.Start(ctx); err != nil {
+			return
+		}
+	}
 
 	connStr, err := c.PortEndpoint(ctx, mappedPort, proto)
 	if err != nil {
@@ -74,6 +103,7 @@ func RunWithContext(ctx context.Context, options ...options.Option) (con *Contai
 		ConnectionString: connStr,
 	}
 
+	err = setup.start(ctx, con)
 	return
 }
 
@@ -0,0 +1,179 @@
+package testnats
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	embeddedHost    = "127.0.0.1"
+	embeddedCommand = "nats-server"
+)
+
+// RunEmbedded starts a NATS server in-process instead of in a docker Container.
+// The same options as Run are accepted, although only the command line arguments they set are used, e.g., WithJetStream.
+// The JetStream store dir is a temporary directory that is removed when the server is terminated.
+// Note: The returned Container has no underlying docker Container, only ConnectionString, the connection
+// helpers and Terminate may be used.
+// A default context is used with a timeout of two minutes. To customize use RunEmbeddedWithContext.
+func RunEmbedded(opts ...options.Option) (*Container, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return RunEmbeddedWithContext(ctx, opts...)
+}
+
+// RunEmbeddedWithContext starts a NATS server in-process instead of in a docker Container.
+// The same options as RunWithContext are accepted, although only the command line arguments they set are used, e.g., WithJetStream.
+// The JetStream store dir is a temporary directory that is removed when the server is terminated.
+// Note: The returned Container has no underlying docker Container, only ConnectionString, the connection
+// helpers and Terminate may be used.
+func RunEmbeddedWithContext(ctx context.Context, opts ...options.Option) (*Container, error) {
+	storeDir, err := os.MkdirTemp("", "testnats")
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := runEmbedded(ctx, storeDir, opts)
+	if err != nil {
+		_ = os.RemoveAll(storeDir)
+		return nil, err
+	}
+
+	con.tempStoreDir = storeDir
+	return con, nil
+}
+
+// RunEmbeddedTest starts a NATS server in-process instead of in a docker Container.
+// The JetStream store dir is in t.TempDir().
+// The server is automatically terminated after the test is finished.
+// A default context is used with a timeout of two minutes. To customize use RunEmbeddedTestWithContext.
+func RunEmbeddedTest(t *testing.T, opts ...options.Option) (*Container, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return RunEmbeddedTestWithContext(t, ctx, opts...)
+}
+
+// RunEmbeddedTestWithContext starts a NATS server in-process instead of in a docker Container.
+// The JetStream store dir is in t.TempDir().
+// The server is automatically terminated after the test is finished.
+func RunEmbeddedTestWithContext(t *testing.T, ctx context.Context, opts ...options.Option) (*Container, error) {
+	con, err := runEmbedded(ctx, t.TempDir(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+		defer cancel()
+		if err := con.Terminate(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return con, nil
+}
+
+// Terminate stops the NATS server, whether it runs in-process or in a docker Container.
+func (c *Container) Terminate(ctx context.Context) error {
+	if c.server == nil {
+		return c.Container.Terminate(ctx)
+	}
+
+	c.server.Shutdown()
+	c.server.WaitForShutdown()
+	if c.tempStoreDir != "" {
+		return os.RemoveAll(c.tempStoreDir)
+	}
+	return nil
+}
+
+// runEmbedded starts a NATS server in-process configured by the command line arguments of the ContainerRequest made by opts.
+func runEmbedded(ctx context.Context, storeDir string, opts []options.Option) (*Container, error) {
+	cReq := tc.ContainerRequest{Image: image}
+	for _, opt := range opts {
+		if err := opt(&cReq); err != nil {
+			return nil, err
+		}
+	}
+
+	setup, err := takeRunSetup(&cReq, storeDir)
+	if err != nil {
+		return nil, err
+	}
+	if setup.config != "" {
+		path, err := setup.writeConfig(storeDir)
+		if err != nil {
+			return nil, err
+		}
+		cReq.Cmd = append(cReq.Cmd, cmdConfig, path)
+	}
+
+	serverOpts, err := makeServerOptions(cReq.Cmd, storeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := natsserver.NewServer(serverOpts)
+	if err != nil {
+		return nil, err
+	}
+	go server.Start()
+
+	timeout := testDuration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if !server.ReadyForConnections(timeout) {
+		server.Shutdown()
+		return nil, errors.New("embedded NATS server is not ready for connections")
+	}
+
+	con := &Container{
+		req:              cReq,
+		ConnectionString: server.ClientURL(),
+		server:           server,
+	}
+
+	if err := setup.start(ctx, con); err != nil {
+		server.Shutdown()
+		return nil, err
+	}
+
+	return con, nil
+}
+
+// makeServerOptions parses args the same as the nats-server command does.
+// The server listens on a random local port and stores JetStream data in storeDir unless args say otherwise.
+func makeServerOptions(args []string, storeDir string) (*natsserver.Options, error) {
+	fs := flag.NewFlagSet(embeddedCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	noop := func() {}
+	opts, err := natsserver.ConfigureOptions(fs, args, noop, noop, noop)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Host == "" {
+		opts.Host = embeddedHost
+	}
+	if opts.Port == 0 {
+		opts.Port = natsserver.RANDOM_PORT
+	}
+	if opts.StoreDir == "" {
+		opts.StoreDir = storeDir
+	}
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	return opts, nil
+}
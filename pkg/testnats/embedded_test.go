@@ -0,0 +1,92 @@
+package testnats
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+func TestRunEmbedded(t *testing.T) {
+	t.Run("should start server", func(t *testing.T) {
+		con, err := RunEmbedded(WithJetStream())
+		assert.NoError(t, err)
+		assert.NotNil(t, con)
+		assert.NotEmpty(t, con.ConnectionString)
+
+		t.Run("can connect", func(t *testing.T) {
+			conn, err := con.NewTestConnection(t)
+			assert.NoError(t, err)
+			assert.Equal(t, nats.CONNECTED, conn.Status())
+		})
+		t.Run("can use JetStream", func(t *testing.T) {
+			js, err := con.NewTestJetStream(t)
+			assert.NoError(t, err)
+			_, err = js.AddStream(&nats.StreamConfig{Name: "orders", Subjects: []string{"orders.>"}})
+			assert.NoError(t, err)
+			_, err = js.Publish("orders.created", []byte("1"))
+			assert.NoError(t, err)
+		})
+		t.Run("can terminate", func(t *testing.T) {
+			assert.NoError(t, con.Terminate(context.Background()))
+			_, err := os.Stat(con.tempStoreDir)
+			assert.True(t, os.IsNotExist(err))
+		})
+	})
+	t.Run("forwards opts errors", func(t *testing.T) {
+		testErr := errors.New("test error")
+		con, err := RunEmbedded(func(request *tc.ContainerRequest) error {
+			return testErr
+		})
+		assert.ErrorIs(t, err, testErr)
+		assert.Nil(t, con)
+	})
+	t.Run("forwards invalid arguments", func(t *testing.T) {
+		con, err := RunEmbedded(func(request *tc.ContainerRequest) error {
+			request.Cmd = append(request.Cmd, "--unknown")
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Nil(t, con)
+	})
+}
+
+func TestRunEmbeddedTest(t *testing.T) {
+	var con *Container
+	t.Run("subtest", func(t *testing.T) {
+		var err error
+		con, err = RunEmbeddedTest(t, WithJetStream())
+		assert.NoError(t, err)
+
+		js, err := con.NewTestJetStream(t)
+		assert.NoError(t, err)
+		_, err = js.AddStream(&nats.StreamConfig{Name: "orders"})
+		assert.NoError(t, err)
+	})
+
+	_, err := nats.Connect(con.ConnectionString, nats.NoReconnect())
+	assert.Error(t, err, "server is terminated after the test")
+}
+
+func TestMakeServerOptions(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		opts, err := makeServerOptions(nil, "/tmp/store")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", opts.Host)
+		assert.Equal(t, -1, opts.Port)
+		assert.Equal(t, "/tmp/store", opts.StoreDir)
+		assert.False(t, opts.JetStream)
+		assert.True(t, opts.NoLog)
+	})
+	t.Run("arguments", func(t *testing.T) {
+		opts, err := makeServerOptions([]string{"-js", "-p", "4333", "-sd", "/data"}, "/tmp/store")
+		assert.NoError(t, err)
+		assert.True(t, opts.JetStream)
+		assert.Equal(t, 4333, opts.Port)
+		assert.Equal(t, "/data", opts.StoreDir)
+	})
+}
@@ -0,0 +1,208 @@
+package testnats
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	namespacePrefix = "test_"
+	subjectSep      = "."
+	nameSep         = "_"
+)
+
+// Namespace isolates a test from other tests sharing the same Container by prefixing every subject,
+// stream, key value bucket and object store it uses with a unique prefix.
+// Subjects are given to a Namespace unprefixed, e.g., Publish("orders.created", ...) publishes to `<prefix>.orders.created`.
+// Streams, buckets and stores created through a Namespace are deleted after the test finishes, so tests using
+// their own Namespace can safely call t.Parallel().
+type Namespace struct {
+	// Prefix is prepended to subjects as `<prefix>.` and to names as `<prefix>_`.
+	Prefix string
+
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	mu      sync.Mutex
+	created Spec
+}
+
+// NewTestNamespace creates a Namespace with a unique prefix and its NATS connection to the underlying docker Container.
+// The connection is closed and everything created through the Namespace is deleted after t is finished.
+// A default context is used with a timeout of two minutes. To customize use NewTestNamespaceWithContext.
+//
+// To use streams, key value buckets or object stores the Container must be created with the WithJetStream option.
+func (c *Container) NewTestNamespace(t *testing.T, options ...nats.Option) (*Namespace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return c.NewTestNamespaceWithContext(t, ctx, options...)
+}
+
+// NewTestNamespaceWithContext creates a Namespace with a unique prefix and its NATS connection to the underlying docker Container.
+// The connection is closed and everything created through the Namespace is deleted after t is finished.
+//
+// To use streams, key value buckets or object stores the Container must be created with the WithJetStream option.
+func (c *Container) NewTestNamespaceWithContext(t *testing.T, ctx context.Context, options ...nats.Option) (*Namespace, error) {
+	conn, err := c.NewConnectionWithContext(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ns := &Namespace{
+		Prefix: namespacePrefix + common.GenerateId(),
+		conn:   conn,
+		js:     js,
+	}
+
+	t.Cleanup(func() {
+		defer conn.Close()
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		if err := ns.created.Delete(js); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return ns, nil
+}
+
+// Subject returns subject within the Namespace.
+func (n *Namespace) Subject(subject string) string {
+	return n.Prefix + subjectSep + subject
+}
+
+// TrimSubject returns subject without the prefix of the Namespace, e.g., to check the subject of a received nats.Msg.
+func (n *Namespace) TrimSubject(subject string) string {
+	return strings.TrimPrefix(subject, n.Prefix+subjectSep)
+}
+
+// Name returns the name of a stream, key value bucket or object store within the Namespace.
+func (n *Namespace) Name(name string) string {
+	return n.Prefix + nameSep + name
+}
+
+// Conn returns the NATS connection of the Namespace. Subjects used with it directly are not prefixed.
+func (n *Namespace) Conn() *nats.Conn {
+	return n.conn
+}
+
+// JetStream returns the JetStreamContext of the Namespace. Subjects and names used with it directly are not prefixed.
+func (n *Namespace) JetStream() nats.JetStreamContext {
+	return n.js
+}
+
+// Publish publishes data to subject within the Namespace.
+func (n *Namespace) Publish(subject string, data []byte) error {
+	return n.conn.Publish(n.Subject(subject), data)
+}
+
+// Request sends a request with data to subject within the Namespace and waits up to timeout for the response.
+func (n *Namespace) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	return n.conn.Request(n.Subject(subject), data, timeout)
+}
+
+// Subscribe subscribes cb to subject within the Namespace.
+func (n *Namespace) Subscribe(subject string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	return n.conn.Subscribe(n.Subject(subject), cb)
+}
+
+// SubscribeSync subscribes synchronously to subject within the Namespace.
+func (n *Namespace) SubscribeSync(subject string) (*nats.Subscription, error) {
+	return n.conn.SubscribeSync(n.Subject(subject))
+}
+
+// QueueSubscribe subscribes cb to subject within the Namespace as a member of queue.
+func (n *Namespace) QueueSubscribe(subject, queue string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	return n.conn.QueueSubscribe(n.Subject(subject), queue, cb)
+}
+
+// PublishJetStream publishes data to subject within the Namespace and waits for the acknowledgement of the stream.
+func (n *Namespace) PublishJetStream(subject string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	return n.js.Publish(n.Subject(subject), data, opts...)
+}
+
+// AddStream creates a stream with its name and subjects within the Namespace.
+// A stream without subjects captures the subject of its name, as it does outside of the Namespace.
+// The stream is deleted after the test finishes.
+func (n *Namespace) AddStream(cfg *nats.StreamConfig) (*nats.StreamInfo, error) {
+	stream := n.stream(StreamSpec{StreamConfig: *cfg})
+	info, err := n.js.AddStream(&stream.StreamConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	n.track(&Spec{Streams: []StreamSpec{stream}})
+	return info, nil
+}
+
+// ApplySpec creates the streams, consumers, key value buckets and object stores of spec within the Namespace.
+// Names, subjects and the filter and deliver subjects of consumers are prefixed. Everything is deleted after the test finishes.
+func (n *Namespace) ApplySpec(spec *Spec) error {
+	prefixed := n.spec(spec)
+	/// Track first so that resources created before a failure are deleted as well.
+	n.track(prefixed)
+	return prefixed.Apply(n.js)
+}
+
+// spec returns a copy of spec within the Namespace.
+func (n *Namespace) spec(spec *Spec) *Spec {
+	prefixed := &Spec{}
+	for _, stream := range spec.Streams {
+		prefixed.Streams = append(prefixed.Streams, n.stream(stream))
+	}
+	for _, kv := range spec.KeyValues {
+		kv.Bucket = n.Name(kv.Bucket)
+		prefixed.KeyValues = append(prefixed.KeyValues, kv)
+	}
+	for _, obj := range spec.ObjectStores {
+		obj.Bucket = n.Name(obj.Bucket)
+		prefixed.ObjectStores = append(prefixed.ObjectStores, obj)
+	}
+	return prefixed
+}
+
+// stream returns a copy of stream within the Namespace.
+func (n *Namespace) stream(stream StreamSpec) StreamSpec {
+	prefixed := StreamSpec{StreamConfig: stream.StreamConfig}
+	prefixed.Name = n.Name(stream.Name)
+
+	/// JetStream defaults the subjects to the stream name, which must be prefixed as well.
+	subjects := stream.Subjects
+	if len(subjects) == 0 {
+		subjects = []string{stream.Name}
+	}
+	prefixed.Subjects = nil
+	for _, subject := range subjects {
+		prefixed.Subjects = append(prefixed.Subjects, n.Subject(subject))
+	}
+
+	for _, consumer := range stream.Consumers {
+		cfg := *consumer
+		if cfg.FilterSubject != "" {
+			cfg.FilterSubject = n.Subject(cfg.FilterSubject)
+		}
+		if cfg.DeliverSubject != "" {
+			cfg.DeliverSubject = n.Subject(cfg.DeliverSubject)
+		}
+		prefixed.Consumers = append(prefixed.Consumers, &cfg)
+	}
+	return prefixed
+}
+
+// track records the resources of spec for deletion after the test finishes.
+func (n *Namespace) track(spec *Spec) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.created.merge(spec)
+}
@@ -0,0 +1,113 @@
+package testnats
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainer_NewTestNamespace(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithJetStream())
+	assert.NoError(t, err)
+
+	js, err := con.NewTestJetStream(t)
+	assert.NoError(t, err)
+
+	t.Run("isolates subjects", func(t *testing.T) {
+		a, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+		b, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+		assert.NotEqual(t, a.Prefix, b.Prefix)
+
+		subA, err := a.SubscribeSync("orders.*")
+		assert.NoError(t, err)
+		subB, err := b.SubscribeSync("orders.*")
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.Publish("orders.created", []byte("a")))
+		assert.NoError(t, a.Conn().Flush())
+
+		msg, err := subA.NextMsg(time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, a.Prefix+".orders.created", msg.Subject)
+		assert.Equal(t, "orders.created", a.TrimSubject(msg.Subject))
+
+		_, err = subB.NextMsg(time.Millisecond * 100)
+		assert.ErrorIs(t, err, nats.ErrTimeout)
+	})
+	t.Run("requests", func(t *testing.T) {
+		ns, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+
+		_, err = ns.Subscribe("echo", func(msg *nats.Msg) {
+			_ = msg.Respond(msg.Data)
+		})
+		assert.NoError(t, err)
+
+		msg, err := ns.Request("echo", []byte("hello"), time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(msg.Data))
+	})
+
+	var created []string
+	t.Run("prefixes streams", func(t *testing.T) {
+		ns, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+
+		info, err := ns.AddStream(&nats.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}})
+		assert.NoError(t, err)
+		assert.Equal(t, ns.Name("EVENTS"), info.Config.Name)
+		assert.Equal(t, []string{ns.Subject("events.>")}, info.Config.Subjects)
+
+		ack, err := ns.PublishJetStream("events.created", []byte("1"))
+		assert.NoError(t, err)
+		assert.Equal(t, ns.Name("EVENTS"), ack.Stream)
+		created = append(created, info.Config.Name)
+	})
+	t.Run("defaults stream subjects to the name", func(t *testing.T) {
+		ns, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+
+		info, err := ns.AddStream(&nats.StreamConfig{Name: "AUDIT"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ns.Subject("AUDIT")}, info.Config.Subjects)
+
+		ack, err := ns.PublishJetStream("AUDIT", []byte("1"))
+		assert.NoError(t, err)
+		assert.Equal(t, ns.Name("AUDIT"), ack.Stream)
+		created = append(created, info.Config.Name)
+	})
+	t.Run("prefixes specs", func(t *testing.T) {
+		ns, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+
+		spec, err := LoadSpec(os.DirFS("testdata"), "jetstream.json")
+		assert.NoError(t, err)
+		assert.NoError(t, ns.ApplySpec(spec))
+
+		consumer, err := ns.JetStream().ConsumerInfo(ns.Name("ORDERS"), "processor")
+		assert.NoError(t, err)
+		assert.Equal(t, ns.Subject("orders.created"), consumer.Config.FilterSubject)
+
+		_, err = ns.JetStream().KeyValue(ns.Name("settings"))
+		assert.NoError(t, err)
+		_, err = ns.JetStream().ObjectStore(ns.Name("files"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ORDERS", spec.Streams[0].Name, "spec is not modified")
+
+		created = append(created, ns.Name("ORDERS"), "KV_"+ns.Name("settings"), "OBJ_"+ns.Name("files"))
+	})
+
+	for _, name := range created {
+		_, err := js.StreamInfo(name)
+		assert.ErrorIs(t, err, nats.ErrStreamNotFound, name)
+	}
+	for name := range js.StreamNames() {
+		assert.False(t, strings.HasPrefix(name, namespacePrefix), name)
+	}
+}
@@ -5,6 +5,12 @@ import (
 	tc "github.com/testcontainers/testcontainers-go"
 )
 
+const (
+	env_TESTDEPS_NATS_SPEC     = "TESTDEPS_NATS_SPEC"
+	env_TESTDEPS_NATS_CONFIG   = "TESTDEPS_NATS_CONFIG"
+	env_TESTDEPS_NATS_ACCOUNTS = "TESTDEPS_NATS_ACCOUNTS"
+)
+
 // WithJetStream enables JetStream in the NATS Container.
 // This is the equivalent of running nats -js.
 func WithJetStream() options.Option {
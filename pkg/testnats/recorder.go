@@ -0,0 +1,358 @@
+package testnats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	tokenWildcard = "*"
+	tailWildcard  = ">"
+)
+
+// Recorder subscribes to subjects, or a JetStream consumer, and buffers every message it receives.
+// Use the Expect... methods to assert on messages instead of sleeping.
+type Recorder struct {
+	subs    []*nats.Subscription
+	subject func(subject string) string
+
+	mu       sync.Mutex
+	received []*nats.Msg
+	pending  []*nats.Msg
+	changed  chan struct{}
+	closed   bool
+}
+
+// NewRecorder subscribes to the given subjects, which may contain wildcards, on conn.
+// Messages published after NewRecorder returns are guaranteed to be recorded.
+// The recorder must be closed by the caller.
+func NewRecorder(conn *nats.Conn, subjects ...string) (*Recorder, error) {
+	return newRecorder(conn, subjects, func(subject string) string { return subject })
+}
+
+// NewTestRecorder subscribes to the given subjects, which may contain wildcards, on conn.
+// Messages published after NewTestRecorder returns are guaranteed to be recorded.
+// The recorder is automatically closed after t is finished.
+func NewTestRecorder(t *testing.T, conn *nats.Conn, subjects ...string) (*Recorder, error) {
+	r, err := NewRecorder(conn, subjects...)
+	if err != nil {
+		return nil, err
+	}
+	r.closeOnCleanup(t)
+	return r, nil
+}
+
+// NewJetStreamRecorder creates a JetStream subscription to subject configured by opts, e.g.,
+// nats.Durable or nats.DeliverAll, and records the messages the consumer delivers. Messages are acknowledged once recorded.
+// The recorder must be closed by the caller.
+func NewJetStreamRecorder(js nats.JetStreamContext, subject string, opts ...nats.SubOpt) (*Recorder, error) {
+	r := &Recorder{
+		subject: func(subject string) string { return subject },
+		changed: make(chan struct{}),
+	}
+
+	sub, err := js.Subscribe(subject, r.record, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.subs = append(r.subs, sub)
+	return r, nil
+}
+
+// NewTestJetStreamRecorder creates a JetStream subscription to subject configured by opts, e.g.,
+// nats.Durable or nats.DeliverAll, and records the messages the consumer delivers. Messages are acknowledged once recorded.
+// The recorder is automatically closed after t is finished.
+func NewTestJetStreamRecorder(t *testing.T, js nats.JetStreamContext, subject string, opts ...nats.SubOpt) (*Recorder, error) {
+	r, err := NewJetStreamRecorder(js, subject, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.closeOnCleanup(t)
+	return r, nil
+}
+
+// NewTestRecorder subscribes to the given subjects within the Namespace.
+// Subjects given to the Expect... methods of the recorder are within the Namespace as well.
+// The recorder is automatically closed after t is finished.
+func (n *Namespace) NewTestRecorder(t *testing.T, subjects ...string) (*Recorder, error) {
+	prefixed := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		prefixed = append(prefixed, n.Subject(subject))
+	}
+
+	r, err := newRecorder(n.conn, prefixed, n.Subject)
+	if err != nil {
+		return nil, err
+	}
+	r.closeOnCleanup(t)
+	return r, nil
+}
+
+// Messages returns every message received so far, including those already matched by an expectation.
+func (r *Recorder) Messages() []*nats.Msg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*nats.Msg(nil), r.received...)
+}
+
+// WaitForMessages blocks until count messages on subject, which may contain wildcards, are received.
+// An empty subject matches any. The matched messages are consumed so consecutive calls match distinct messages.
+func (r *Recorder) WaitForMessages(ctx context.Context, subject string, count int) ([]*nats.Msg, error) {
+	return r.wait(ctx, subject, count, nil)
+}
+
+// WaitForJSON blocks until a message on subject with a JSON body matching expected is received.
+// expected is marshalled to JSON and matches when every field it has is equal in the body, e.g.,
+// map[string]interface{}{"status": "paid"} matches {"id": 1, "status": "paid"}.
+// The matched message is consumed so consecutive calls match distinct messages.
+func (r *Recorder) WaitForJSON(ctx context.Context, subject string, expected interface{}) (*nats.Msg, error) {
+	pattern, err := json.Marshal(expected)
+	if err != nil {
+		return nil, err
+	}
+
+	var want interface{}
+	if err := json.Unmarshal(pattern, &want); err != nil {
+		return nil, err
+	}
+
+	msgs, err := r.wait(ctx, subject, 1, func(msg *nats.Msg) bool {
+		var body interface{}
+		return json.Unmarshal(msg.Data, &body) == nil && matchesJSON(body, want)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("matching %s: %w", pattern, err)
+	}
+	return msgs[0], nil
+}
+
+// ExpectMessage fails t unless a message on subject is received within timeout and returns it.
+// The matched message is consumed so consecutive calls match distinct messages.
+func (r *Recorder) ExpectMessage(t testing.TB, subject string, timeout time.Duration) *nats.Msg {
+	t.Helper()
+
+	if msgs := r.ExpectMessages(t, subject, 1, timeout); len(msgs) > 0 {
+		return msgs[0]
+	}
+	return nil
+}
+
+// ExpectMessages fails t unless count messages on subject are received within timeout,
+// e.g., ExpectMessages(t, "orders.*", 3, time.Second). The matched messages are consumed.
+func (r *Recorder) ExpectMessages(t testing.TB, subject string, count int, timeout time.Duration) []*nats.Msg {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msgs, err := r.WaitForMessages(ctx, subject, count)
+	if err != nil {
+		t.Errorf("expected %d messages within %s: %s", count, timeout, err.Error())
+	}
+	return msgs
+}
+
+// ExpectJSON fails t unless a message on subject with a JSON body matching expected is received within timeout,
+// e.g., ExpectJSON(t, "orders.created", map[string]interface{}{"status": "paid"}, time.Second).
+// See WaitForJSON for how bodies are matched. The matched message is consumed.
+func (r *Recorder) ExpectJSON(t testing.TB, subject string, expected interface{}, timeout time.Duration) *nats.Msg {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg, err := r.WaitForJSON(ctx, subject, expected)
+	if err != nil {
+		t.Errorf("expected message within %s: %s", timeout, err.Error())
+	}
+	return msg
+}
+
+// ExpectNoMessages fails t if any unmatched message on subject is received within the given duration.
+// An empty subject matches any.
+func (r *Recorder) ExpectNoMessages(t testing.TB, subject string, within time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), within)
+	defer cancel()
+
+	if msgs, err := r.WaitForMessages(ctx, subject, 1); err == nil {
+		t.Errorf("expected no further messages, got one on %q", msgs[0].Subject)
+	}
+}
+
+// Close unsubscribes from every subject of the recorder.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.changed)
+	r.mu.Unlock()
+
+	var errs []string
+	for _, sub := range r.subs {
+		if err := sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) && !errors.Is(err, nats.ErrBadSubscription) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func newRecorder(conn *nats.Conn, subjects []string, subject func(string) string) (*Recorder, error) {
+	r := &Recorder{
+		subject: subject,
+		changed: make(chan struct{}),
+	}
+
+	for _, s := range subjects {
+		sub, err := conn.Subscribe(s, r.record)
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		r.subs = append(r.subs, sub)
+	}
+
+	/// Make sure the server knows about the subscriptions before anything is published.
+	if err := conn.Flush(); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) closeOnCleanup(t *testing.T) {
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func (r *Recorder) record(msg *nats.Msg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	r.received = append(r.received, msg)
+	r.pending = append(r.pending, msg)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// wait blocks until count pending messages on subject that satisfy match, if given, are received and consumes them.
+func (r *Recorder) wait(ctx context.Context, subject string, count int, match func(msg *nats.Msg) bool) ([]*nats.Msg, error) {
+	pattern := subject
+	if pattern != "" {
+		pattern = r.subject(subject)
+	}
+
+	for {
+		msgs, found, changed, err := r.take(pattern, count, match)
+		if found {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%d of %d messages on %q: %w", len(msgs), count, subject, ctx.Err())
+		}
+	}
+}
+
+// take removes and returns the first count pending messages that match.
+// If fewer match it returns them without removing them, along with a channel that is closed when the next message arrives.
+func (r *Recorder) take(pattern string, count int, match func(msg *nats.Msg) bool) (msgs []*nats.Msg, found bool, changed <-chan struct{}, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var indexes []int
+	for i, msg := range r.pending {
+		if len(indexes) == count {
+			break
+		}
+		if (pattern == "" || matchesSubject(pattern, msg.Subject)) && (match == nil || match(msg)) {
+			indexes = append(indexes, i)
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(indexes) == count {
+		for i := len(indexes) - 1; i >= 0; i-- {
+			r.pending = append(r.pending[:indexes[i]], r.pending[indexes[i]+1:]...)
+		}
+		return msgs, true, nil, nil
+	}
+
+	if r.closed {
+		return msgs, false, nil, errors.New("recorder is closed")
+	}
+	return msgs, false, r.changed, nil
+}
+
+// matchesSubject reports whether subject matches pattern, which may contain the wildcards `*` and `>`.
+func matchesSubject(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, subjectSep)
+	subjectTokens := strings.Split(subject, subjectSep)
+
+	for i, token := range patternTokens {
+		if token == tailWildcard {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != tokenWildcard && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// matchesJSON reports whether every field of expected is equal in actual. Arrays must have the same length.
+func matchesJSON(actual, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actual, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range expected {
+			if v, exists := actual[key]; !exists || !matchesJSON(v, value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actual, ok := actual.([]interface{})
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !matchesJSON(actual[i], expected[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(actual, expected)
+	}
+}
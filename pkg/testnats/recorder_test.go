@@ -0,0 +1,136 @@
+package testnats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/internal/testutil"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithJetStream())
+	assert.NoError(t, err)
+
+	conn, err := con.NewTestConnection(t)
+	assert.NoError(t, err)
+
+	t.Run("expects messages", func(t *testing.T) {
+		r, err := NewTestRecorder(t, conn, "orders.*", "payments.>")
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, conn.Publish(fmt.Sprintf("orders.%d", i), []byte("{}")))
+		}
+		assert.NoError(t, conn.Publish("payments.card.captured", []byte("{}")))
+
+		msgs := r.ExpectMessages(t, "orders.*", 3, time.Second)
+		assert.Len(t, msgs, 3)
+		assert.Equal(t, "orders.0", msgs[0].Subject)
+		r.ExpectMessage(t, "payments.>", time.Second)
+		r.ExpectNoMessages(t, "", time.Millisecond*50)
+		assert.Len(t, r.Messages(), 4)
+	})
+	t.Run("expects JSON", func(t *testing.T) {
+		r, err := NewTestRecorder(t, conn, "orders.>")
+		assert.NoError(t, err)
+
+		assert.NoError(t, conn.Publish("orders.created", []byte(`{"id": 1, "status": "new", "items": [{"sku": "a"}]}`)))
+		assert.NoError(t, conn.Publish("orders.updated", []byte(`{"id": 1, "status": "paid", "total": 9.5}`)))
+
+		msg := r.ExpectJSON(t, "orders.*", map[string]interface{}{"status": "paid", "total": 9.5}, time.Second)
+		assert.Equal(t, "orders.updated", msg.Subject)
+		msg = r.ExpectJSON(t, "", map[string]interface{}{"items": []map[string]string{{"sku": "a"}}}, time.Second)
+		assert.Equal(t, "orders.created", msg.Subject)
+	})
+	t.Run("fails expectations", func(t *testing.T) {
+		r, err := NewTestRecorder(t, conn, "orders.>")
+		assert.NoError(t, err)
+		assert.NoError(t, conn.Publish("orders.created", []byte(`{"status": "new"}`)))
+
+		rec := &testutil.RecordingTB{TB: t}
+		r.ExpectMessages(rec, "orders.created", 2, time.Millisecond*50)
+		r.ExpectJSON(rec, "orders.created", map[string]interface{}{"status": "paid"}, time.Millisecond*50)
+		r.ExpectNoMessages(rec, "orders.created", time.Millisecond*50)
+		assert.Equal(t, []string{
+			`expected 2 messages within 50ms: 1 of 2 messages on "orders.created": context deadline exceeded`,
+			`expected message within 50ms: matching {"status":"paid"}: 0 of 1 messages on "orders.created": context deadline exceeded`,
+			`expected no further messages, got one on "orders.created"`,
+		}, rec.Messages())
+	})
+	t.Run("stops waiting when closed", func(t *testing.T) {
+		r, err := NewRecorder(conn, "orders.>")
+		assert.NoError(t, err)
+
+		go func() {
+			time.Sleep(time.Millisecond * 10)
+			_ = r.Close()
+		}()
+		_, err = r.WaitForMessages(context.Background(), "", 1)
+		assert.Error(t, err)
+		assert.NoError(t, r.Close())
+	})
+	t.Run("records JetStream consumers", func(t *testing.T) {
+		js, err := con.NewTestJetStream(t)
+		assert.NoError(t, err)
+		_, err = js.AddStream(&nats.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}})
+		assert.NoError(t, err)
+		_, err = js.Publish("events.created", []byte(`{"id": 1}`))
+		assert.NoError(t, err)
+
+		r, err := NewTestJetStreamRecorder(t, js, "events.>", nats.DeliverAll())
+		assert.NoError(t, err)
+		msg := r.ExpectJSON(t, "events.created", map[string]int{"id": 1}, time.Second)
+		assert.NotNil(t, msg)
+	})
+	t.Run("records within namespace", func(t *testing.T) {
+		ns, err := con.NewTestNamespace(t)
+		assert.NoError(t, err)
+		r, err := ns.NewTestRecorder(t, "orders.*")
+		assert.NoError(t, err)
+
+		assert.NoError(t, conn.Publish("orders.created", []byte("{}")))
+		assert.NoError(t, ns.Publish("orders.created", []byte("{}")))
+
+		msg := r.ExpectMessage(t, "orders.created", time.Second)
+		assert.Equal(t, ns.Subject("orders.created"), msg.Subject)
+		r.ExpectNoMessages(t, "orders.*", time.Millisecond*50)
+	})
+}
+
+func TestMatchesSubject(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, subject string
+		matches          bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.updated", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.v1", false},
+		{"orders.>", "orders.created.v1", true},
+		{"orders.>", "orders", false},
+		{"*.created", "orders.created", true},
+		{"orders", "orders.created", false},
+	} {
+		assert.Equal(t, tc.matches, matchesSubject(tc.pattern, tc.subject), "%s %s", tc.pattern, tc.subject)
+	}
+}
+
+func TestMatchesJSON(t *testing.T) {
+	actual := map[string]interface{}{
+		"id":     float64(1),
+		"status": "paid",
+		"items":  []interface{}{map[string]interface{}{"sku": "a", "qty": float64(2)}},
+	}
+
+	assert.True(t, matchesJSON(actual, map[string]interface{}{}))
+	assert.True(t, matchesJSON(actual, map[string]interface{}{"status": "paid"}))
+	assert.True(t, matchesJSON(actual, map[string]interface{}{"items": []interface{}{map[string]interface{}{"sku": "a"}}}))
+	assert.False(t, matchesJSON(actual, map[string]interface{}{"status": "new"}))
+	assert.False(t, matchesJSON(actual, map[string]interface{}{"missing": nil}))
+	assert.False(t, matchesJSON(actual, map[string]interface{}{"items": []interface{}{}}))
+	assert.False(t, matchesJSON("text", map[string]interface{}{}))
+}
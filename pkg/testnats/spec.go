@@ -0,0 +1,298 @@
+package testnats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/options"
+	"github.com/nats-io/nats.go"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+// Spec declares JetStream streams with their consumers, key value buckets and object stores.
+// Specs are either built in Go or loaded from a JSON file with LoadSpec, e.g.,
+//
+//	{
+//	  "streams": [
+//	    {
+//	      "name": "ORDERS",
+//	      "subjects": ["orders.>"],
+//	      "storage": "memory",
+//	      "consumers": [{"durable_name": "processor", "ack_policy": "explicit"}]
+//	    }
+//	  ],
+//	  "key_values": [{"bucket": "settings", "history": 5}],
+//	  "object_stores": [{"bucket": "files"}]
+//	}
+//
+// Streams and consumers use the JSON field names of the JetStream API. Key value buckets accept "bucket",
+// "description", "max_value_size", "history", "ttl", "max_bytes", "storage", "num_replicas" and "placement".
+// Object stores accept "bucket", "description", "ttl", "storage", "num_replicas" and "placement".
+// Durations are in nanoseconds. Unknown keys are rejected.
+type Spec struct {
+	Streams      []StreamSpec      `json:"streams,omitempty"`
+	KeyValues    []KeyValueSpec    `json:"key_values,omitempty"`
+	ObjectStores []ObjectStoreSpec `json:"object_stores,omitempty"`
+}
+
+// StreamSpec declares a single stream of a Spec along with its consumers.
+type StreamSpec struct {
+	nats.StreamConfig
+	Consumers []*nats.ConsumerConfig `json:"consumers,omitempty"`
+}
+
+// KeyValueSpec declares a key value bucket of a Spec. The fields are those of nats.KeyValueConfig.
+type KeyValueSpec struct {
+	Bucket       string           `json:"bucket"`
+	Description  string           `json:"description,omitempty"`
+	MaxValueSize int32            `json:"max_value_size,omitempty"`
+	History      uint8            `json:"history,omitempty"`
+	TTL          time.Duration    `json:"ttl,omitempty"`
+	MaxBytes     int64            `json:"max_bytes,omitempty"`
+	Storage      nats.StorageType `json:"storage,omitempty"`
+	Replicas     int              `json:"num_replicas,omitempty"`
+	Placement    *nats.Placement  `json:"placement,omitempty"`
+}
+
+// config returns the configuration to create the key value bucket with.
+func (kv KeyValueSpec) config() *nats.KeyValueConfig {
+	cfg := nats.KeyValueConfig(kv)
+	return &cfg
+}
+
+// ObjectStoreSpec declares an object store of a Spec. The fields are those of nats.ObjectStoreConfig.
+type ObjectStoreSpec struct {
+	Bucket      string           `json:"bucket"`
+	Description string           `json:"description,omitempty"`
+	TTL         time.Duration    `json:"ttl,omitempty"`
+	Storage     nats.StorageType `json:"storage,omitempty"`
+	Replicas    int              `json:"num_replicas,omitempty"`
+	Placement   *nats.Placement  `json:"placement,omitempty"`
+}
+
+// config returns the configuration to create the object store with.
+func (obj ObjectStoreSpec) config() *nats.ObjectStoreConfig {
+	cfg := nats.ObjectStoreConfig(obj)
+	return &cfg
+}
+
+// LoadSpec reads and parses the JSON Spec with the given name in fsys.
+func LoadSpec(fsys fs.FS, name string) (*Spec, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing spec %s: %w", name, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses a JSON Spec. Unknown keys are rejected, so misspelled settings do not go unnoticed.
+func ParseSpec(data []byte) (*Spec, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var spec Spec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Apply creates the streams, consumers, key value buckets and object stores of s.
+// Resources that already exist with the same configuration are left as they are.
+func (s *Spec) Apply(js nats.JetStreamContext) error {
+	for _, stream := range s.Streams {
+		cfg := stream.StreamConfig
+		if _, err := js.AddStream(&cfg); err != nil {
+			return fmt.Errorf("creating stream %s: %w", stream.Name, err)
+		}
+
+		for _, consumer := range stream.Consumers {
+			if _, err := js.AddConsumer(stream.Name, consumer); err != nil {
+				return fmt.Errorf("creating consumer %s of stream %s: %w", consumer.Durable, stream.Name, err)
+			}
+		}
+	}
+
+	for _, kv := range s.KeyValues {
+		if _, err := js.CreateKeyValue(kv.config()); err != nil {
+			return fmt.Errorf("creating key value bucket %s: %w", kv.Bucket, err)
+		}
+	}
+
+	for _, obj := range s.ObjectStores {
+		if _, err := js.CreateObjectStore(obj.config()); err != nil {
+			return fmt.Errorf("creating object store %s: %w", obj.Bucket, err)
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes the streams, key value buckets and object stores of s along with their data.
+// Consumers are deleted with their streams. Resources that do not exist are ignored.
+func (s *Spec) Delete(js nats.JetStreamContext) error {
+	for _, stream := range s.Streams {
+		if err := js.DeleteStream(stream.Name); err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+			return fmt.Errorf("deleting stream %s: %w", stream.Name, err)
+		}
+	}
+
+	for _, kv := range s.KeyValues {
+		if err := js.DeleteKeyValue(kv.Bucket); err != nil && !isNotFound(err) {
+			return fmt.Errorf("deleting key value bucket %s: %w", kv.Bucket, err)
+		}
+	}
+
+	for _, obj := range s.ObjectStores {
+		if err := js.DeleteObjectStore(obj.Bucket); err != nil && !isNotFound(err) {
+			return fmt.Errorf("deleting object store %s: %w", obj.Bucket, err)
+		}
+	}
+
+	return nil
+}
+
+// merge appends the resources of other to s.
+func (s *Spec) merge(other *Spec) {
+	s.Streams = append(s.Streams, other.Streams...)
+	s.KeyValues = append(s.KeyValues, other.KeyValues...)
+	s.ObjectStores = append(s.ObjectStores, other.ObjectStores...)
+}
+
+// WithSpec creates the streams, consumers, key value buckets and object stores of spec once the Container is running.
+// JetStream is enabled as with WithJetStream. WithSpec may be given several times, the specs are applied in order.
+func WithSpec(spec *Spec) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		merged, err := requestSpec(*request)
+		if err != nil {
+			return err
+		}
+		if merged == nil {
+			merged = &Spec{}
+		}
+		merged.merge(spec)
+
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+
+		if request.Env == nil {
+			request.Env = make(map[string]string)
+		}
+		request.Env[env_TESTDEPS_NATS_SPEC] = string(data)
+
+		if !jetStreamEnabled(*request) {
+			request.Cmd = append(request.Cmd, cmdJetStreamEnabled)
+		}
+		return nil
+	}
+}
+
+// WithSpecFile is the same as WithSpec with the Spec loaded from the JSON file with the given name in fsys.
+func WithSpecFile(fsys fs.FS, name string) options.Option {
+	return func(request *tc.ContainerRequest) error {
+		spec, err := LoadSpec(fsys, name)
+		if err != nil {
+			return err
+		}
+		return WithSpec(spec)(request)
+	}
+}
+
+// ApplySpec creates the streams, consumers, key value buckets and object stores of spec.
+// A default context is used with a timeout of two minutes. To customize use ApplySpecWithContext.
+func (c *Container) ApplySpec(spec *Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return c.ApplySpecWithContext(ctx, spec)
+}
+
+// ApplySpecWithContext creates the streams, consumers, key value buckets and object stores of spec.
+func (c *Container) ApplySpecWithContext(ctx context.Context, spec *Spec) error {
+	return c.withJetStream(ctx, spec.Apply)
+}
+
+// DeleteSpec deletes the streams, key value buckets and object stores of spec.
+// A default context is used with a timeout of two minutes. To customize use DeleteSpecWithContext.
+func (c *Container) DeleteSpec(spec *Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return c.DeleteSpecWithContext(ctx, spec)
+}
+
+// DeleteSpecWithContext deletes the streams, key value buckets and object stores of spec.
+func (c *Container) DeleteSpecWithContext(ctx context.Context, spec *Spec) error {
+	return c.withJetStream(ctx, spec.Delete)
+}
+
+// ApplyTestSpec creates the streams, consumers, key value buckets and object stores of spec.
+// They are automatically deleted after t is finished.
+// A default context is used with a timeout of two minutes. To customize use ApplyTestSpecWithContext.
+func (c *Container) ApplyTestSpec(t *testing.T, spec *Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	return c.ApplyTestSpecWithContext(t, ctx, spec)
+}
+
+// ApplyTestSpecWithContext creates the streams, consumers, key value buckets and object stores of spec.
+// They are automatically deleted after t is finished.
+func (c *Container) ApplyTestSpecWithContext(t *testing.T, ctx context.Context, spec *Spec) error {
+	t.Cleanup(func() {
+		if err := c.DeleteSpec(spec); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return c.ApplySpecWithContext(ctx, spec)
+}
+
+// withJetStream calls fn with a JetStreamContext bound to ctx on a new connection that is closed afterwards.
+func (c *Container) withJetStream(ctx context.Context, fn func(js nats.JetStreamContext) error) error {
+	conn, err := c.NewConnectionWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	js, err := conn.JetStream(nats.Context(ctx))
+	if err != nil {
+		return err
+	}
+	return fn(js)
+}
+
+// requestSpec returns the Spec set on request by WithSpec, if any.
+func requestSpec(request tc.ContainerRequest) (*Spec, error) {
+	data, exists := request.Env[env_TESTDEPS_NATS_SPEC]
+	if !exists {
+		return nil, nil
+	}
+	return ParseSpec([]byte(data))
+}
+
+// jetStreamEnabled reports whether request enables JetStream.
+func jetStreamEnabled(request tc.ContainerRequest) bool {
+	for _, arg := range request.Cmd {
+		if arg == cmdJetStreamEnabled || arg == "--js" || arg == "-jetstream" || arg == "--jetstream" {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound reports whether err means a key value bucket or object store does not exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, nats.ErrStreamNotFound) || errors.Is(err, nats.ErrBucketNotFound)
+}
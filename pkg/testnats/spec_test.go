@@ -0,0 +1,135 @@
+package testnats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	tc "github.com/testcontainers/testcontainers-go"
+)
+
+func TestLoadSpec(t *testing.T) {
+	spec, err := LoadSpec(os.DirFS("testdata"), "jetstream.json")
+	assert.NoError(t, err)
+
+	assert.Len(t, spec.Streams, 1)
+	assert.Equal(t, "ORDERS", spec.Streams[0].Name)
+	assert.Equal(t, []string{"orders.>"}, spec.Streams[0].Subjects)
+	assert.Equal(t, nats.MemoryStorage, spec.Streams[0].Storage)
+	assert.Len(t, spec.Streams[0].Consumers, 1)
+	assert.Equal(t, "processor", spec.Streams[0].Consumers[0].Durable)
+	assert.Equal(t, nats.AckExplicitPolicy, spec.Streams[0].Consumers[0].AckPolicy)
+
+	assert.Len(t, spec.KeyValues, 1)
+	assert.Equal(t, "settings", spec.KeyValues[0].Bucket)
+	assert.EqualValues(t, 5, spec.KeyValues[0].History)
+
+	assert.Len(t, spec.ObjectStores, 1)
+	assert.Equal(t, "files", spec.ObjectStores[0].Bucket)
+
+	_, err = ParseSpec([]byte("{"))
+	assert.Error(t, err)
+	_, err = ParseSpec([]byte(`{"keyValues": [{"bucket": "settings"}]}`))
+	assert.Error(t, err, "unknown keys are rejected")
+	_, err = ParseSpec([]byte(`{"key_values": [{"bucket": "settings", "max_history": 5}]}`))
+	assert.Error(t, err, "unknown keys are rejected")
+}
+
+func TestParseSpec_KeyValuesAndObjectStores(t *testing.T) {
+	spec, err := ParseSpec([]byte(`{
+	  "key_values": [{"bucket": "settings", "description": "d", "max_value_size": 128, "history": 5, "ttl": 1000000000, "max_bytes": 1024, "storage": "memory", "num_replicas": 1}],
+	  "object_stores": [{"bucket": "files", "ttl": 1000000000, "storage": "memory"}]
+	}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, &nats.KeyValueConfig{
+		Bucket:       "settings",
+		Description:  "d",
+		MaxValueSize: 128,
+		History:      5,
+		TTL:          time.Second,
+		MaxBytes:     1024,
+		Storage:      nats.MemoryStorage,
+		Replicas:     1,
+	}, spec.KeyValues[0].config())
+	assert.Equal(t, &nats.ObjectStoreConfig{
+		Bucket:  "files",
+		TTL:     time.Second,
+		Storage: nats.MemoryStorage,
+	}, spec.ObjectStores[0].config())
+}
+
+func TestWithSpec(t *testing.T) {
+	t.Run("enables JetStream", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithSpec(&Spec{})(&cReq))
+		assert.Equal(t, []string{cmdJetStreamEnabled}, cReq.Cmd)
+
+		cReq = tc.ContainerRequest{}
+		assert.NoError(t, WithJetStream()(&cReq))
+		assert.NoError(t, WithSpec(&Spec{})(&cReq))
+		assert.Equal(t, []string{cmdJetStreamEnabled}, cReq.Cmd)
+	})
+	t.Run("merges specs", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.NoError(t, WithSpec(&Spec{KeyValues: []KeyValueSpec{{Bucket: "a"}}})(&cReq))
+		assert.NoError(t, WithSpec(&Spec{KeyValues: []KeyValueSpec{{Bucket: "b"}}})(&cReq))
+
+		spec, err := requestSpec(cReq)
+		assert.NoError(t, err)
+		assert.Len(t, spec.KeyValues, 2)
+		assert.Equal(t, "a", spec.KeyValues[0].Bucket)
+		assert.Equal(t, "b", spec.KeyValues[1].Bucket)
+	})
+	t.Run("forwards file errors", func(t *testing.T) {
+		cReq := tc.ContainerRequest{}
+		assert.Error(t, WithSpecFile(os.DirFS("testdata"), "missing.json")(&cReq))
+	})
+}
+
+func TestRunEmbedded_WithSpecFile(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithSpecFile(os.DirFS("testdata"), "jetstream.json"))
+	assert.NoError(t, err)
+
+	js, err := con.NewTestJetStream(t)
+	assert.NoError(t, err)
+
+	_, err = js.ConsumerInfo("ORDERS", "processor")
+	assert.NoError(t, err)
+	_, err = js.KeyValue("settings")
+	assert.NoError(t, err)
+	_, err = js.ObjectStore("files")
+	assert.NoError(t, err)
+}
+
+func TestContainer_ApplyTestSpec(t *testing.T) {
+	con, err := RunEmbeddedTest(t, WithJetStream())
+	assert.NoError(t, err)
+
+	spec, err := LoadSpec(os.DirFS("testdata"), "jetstream.json")
+	assert.NoError(t, err)
+
+	js, err := con.NewTestJetStream(t)
+	assert.NoError(t, err)
+
+	t.Run("subtest", func(t *testing.T) {
+		assert.NoError(t, con.ApplyTestSpec(t, spec))
+		assert.NoError(t, con.ApplySpec(spec), "applying twice is allowed")
+
+		_, err := js.Publish("orders.created", []byte("1"))
+		assert.NoError(t, err)
+		_, err = js.KeyValue("settings")
+		assert.NoError(t, err)
+	})
+
+	_, err = js.StreamInfo("ORDERS")
+	assert.ErrorIs(t, err, nats.ErrStreamNotFound)
+	_, err = js.KeyValue("settings")
+	assert.ErrorIs(t, err, nats.ErrBucketNotFound)
+	_, err = js.ObjectStore("files")
+	assert.Error(t, err)
+
+	assert.NoError(t, con.DeleteSpec(spec), "deleting missing resources is allowed")
+}
@@ -9,6 +9,10 @@ type Container struct {
 	tc.Container
 	ConnectionString string
 	driver           string
+
+	/// admin and role are set on copies returned by AsRole.
+	admin *Container
+	role  string
 }
 
 func New(c tc.Container, driver, connectionString string) *Container {
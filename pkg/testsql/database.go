@@ -18,7 +18,11 @@ func (c *Container) NewDatabase(name, migrationsFilepath string) (*sql.DB, error
 
 // NewDatabaseWithContext creates a new mongo.Database with then given name and options.
 // NewDatabaseWithContext exists to allow you to customize the connection process, e.g., apply timeout.
+// On a copy returned by AsRole, the database is created by the superuser, owned by the Role and connected to as the Role.
 func (c *Container) NewDatabaseWithContext(ctx context.Context, name, migrationsFilepath string) (*sql.DB, error) {
+	if c.admin != nil {
+		return c.newRoleDatabaseWithContext(ctx, name, migrationsFilepath)
+	}
 
 	client, err := c.NewClientWithContext(ctx)
 	if err != nil {
@@ -34,20 +38,30 @@ func (c *Container) NewDatabaseWithContext(ctx context.Context, name, migrations
 		return nil, err
 	}
 
-	//TODO: Implement migration level here for schema backwards compatability tests
-	if migrationsFilepath != "" {
-		if !strings.HasPrefix(migrationsFilepath, "file://") {
-			migrationsFilepath = fmt.Sprintf("file://%s", migrationsFilepath)
-		}
-		m, err := migrate.New(migrationsFilepath, c.ConnectionString)
-		if err = m.Up(); err != nil {
-			return nil, err
-		}
+	if err := migrateUp(migrationsFilepath, c.ConnectionString); err != nil {
+		return nil, err
 	}
 
 	return c.NewClientWithContext(ctx)
 }
 
+// migrateUp applies the migrations found at migrationsFilepath, if any, to the database of connStr.
+func migrateUp(migrationsFilepath, connStr string) error {
+	//TODO: Implement migration level here for schema backwards compatability tests
+	if migrationsFilepath == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(migrationsFilepath, "file://") {
+		migrationsFilepath = fmt.Sprintf("file://%s", migrationsFilepath)
+	}
+	m, err := migrate.New(migrationsFilepath, connStr)
+	if err != nil {
+		return err
+	}
+	return m.Up()
+}
+
 // NewTestDatabase creates a new Database with a random name within the Container.
 // The database is automatically dropped after to test it finished.
 // Note: A default context is used with a timeout of two minutes.
@@ -70,6 +84,10 @@ func (c *Container) NewTestDatabaseWithContext(t testing.TB, ctx context.Context
 	}
 
 	t.Cleanup(func() {
+		if c.admin != nil {
+			c.dropRoleDatabase(t, db, name)
+			return
+		}
 		if _, err := db.Exec(fmt.Sprintf("drop database %s", name)); err != nil {
 			t.Error(err)
 		}
@@ -0,0 +1,232 @@
+package testsql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/lib/pq"
+)
+
+const (
+	postgresDriver       = "postgres"
+	listenerMinReconnect = time.Millisecond * 10
+	listenerMaxReconnect = time.Second
+	listenerPingInterval = time.Millisecond * 50
+)
+
+// Notification is a single Postgres NOTIFY received by a NotificationRecorder.
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// NotificationRecorder listens to Postgres channels on a dedicated connection and buffers every notification it receives.
+// Use the Expect... methods to assert on notifications instead of sleeping.
+type NotificationRecorder struct {
+	listener *pq.Listener
+
+	mu       sync.Mutex
+	received []Notification
+	pending  []Notification
+	changed  chan struct{}
+	done     chan struct{}
+}
+
+// NewNotificationRecorder creates a NotificationRecorder listening to the given channels.
+// The recorder must be closed by the caller.
+// A default context is used with a timeout of two minutes. To customize use NewNotificationRecorderWithContext.
+func (c *Container) NewNotificationRecorder(channels ...string) (*NotificationRecorder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewNotificationRecorderWithContext(ctx, channels...)
+}
+
+// NewNotificationRecorderWithContext creates a NotificationRecorder listening to the given channels.
+// The recorder must be closed by the caller.
+// LISTEN/NOTIFY is only supported by Postgres containers.
+func (c *Container) NewNotificationRecorderWithContext(ctx context.Context, channels ...string) (*NotificationRecorder, error) {
+	if c.driver != postgresDriver {
+		return nil, fmt.Errorf("notifications are not supported by the %q driver", c.driver)
+	}
+
+	listener := pq.NewListener(c.ConnectionString, listenerMinReconnect, listenerMaxReconnect, nil)
+	if err := waitForListener(ctx, listener); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	r := &NotificationRecorder{
+		listener: listener,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.record()
+
+	for _, channel := range channels {
+		if err := r.Listen(channel); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// NewTestNotificationRecorder creates a NotificationRecorder listening to the given channels.
+// The recorder is automatically closed after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewTestNotificationRecorder(t testing.TB, channels ...string) (*NotificationRecorder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewTestNotificationRecorderWithContext(t, ctx, channels...)
+}
+
+// NewTestNotificationRecorderWithContext creates a NotificationRecorder listening to the given channels.
+// The recorder is automatically closed after the test finishes.
+func (c *Container) NewTestNotificationRecorderWithContext(t testing.TB, ctx context.Context, channels ...string) (*NotificationRecorder, error) {
+	r, err := c.NewNotificationRecorderWithContext(ctx, channels...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return r, nil
+}
+
+// Listen starts listening to an additional channel.
+// Notifications sent after Listen returns are guaranteed to be recorded.
+func (r *NotificationRecorder) Listen(channel string) error {
+	return r.listener.Listen(channel)
+}
+
+// Notifications returns every notification received so far, including those already matched by an expectation.
+func (r *NotificationRecorder) Notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.received...)
+}
+
+// WaitForNotification blocks until a notification on channel whose payload matches payloadPattern is received.
+// An empty payloadPattern matches any payload.
+// The matched notification is consumed so consecutive calls match distinct notifications.
+func (r *NotificationRecorder) WaitForNotification(ctx context.Context, channel, payloadPattern string) (Notification, error) {
+	payloadRegexp, err := regexp.Compile(payloadPattern)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	for {
+		n, found, changed := r.take(channel, payloadRegexp)
+		if found {
+			return n, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Notification{}, fmt.Errorf("no notification on channel %q with payload matching %q: %w", channel, payloadPattern, ctx.Err())
+		}
+	}
+}
+
+// ExpectNotification fails t unless a notification on channel whose payload matches payloadPattern is received within timeout.
+// An empty payloadPattern matches any payload.
+// The matched notification is consumed so consecutive calls match distinct notifications.
+func (r *NotificationRecorder) ExpectNotification(t testing.TB, channel, payloadPattern string, timeout time.Duration) Notification {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	n, err := r.WaitForNotification(ctx, channel, payloadPattern)
+	if err != nil {
+		t.Errorf("expected notification within %s: %s", timeout, err.Error())
+	}
+	return n
+}
+
+// ExpectNoNotification fails t if any unmatched notification on channel is received within the given duration.
+func (r *NotificationRecorder) ExpectNoNotification(t testing.TB, channel string, within time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), within)
+	defer cancel()
+
+	if n, err := r.WaitForNotification(ctx, channel, ""); err == nil {
+		t.Errorf("expected no notification on channel %q, got payload %q", channel, n.Payload)
+	}
+}
+
+// Close stops listening and closes the dedicated connection.
+func (r *NotificationRecorder) Close() error {
+	err := r.listener.Close()
+	<-r.done
+	return err
+}
+
+func (r *NotificationRecorder) record() {
+	defer close(r.done)
+
+	for notification := range r.listener.Notify {
+		/// pq sends nil after re-establishing a lost connection.
+		if notification == nil {
+			continue
+		}
+
+		n := Notification{
+			Channel: notification.Channel,
+			Payload: notification.Extra,
+		}
+
+		r.mu.Lock()
+		r.received = append(r.received, n)
+		r.pending = append(r.pending, n)
+		close(r.changed)
+		r.changed = make(chan struct{})
+		r.mu.Unlock()
+	}
+}
+
+// take removes and returns the first pending notification that matches.
+// If none matches it returns a channel that is closed when the next notification arrives.
+func (r *NotificationRecorder) take(channel string, payloadRegexp *regexp.Regexp) (n Notification, found bool, changed <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, pending := range r.pending {
+		if pending.Channel == channel && payloadRegexp.MatchString(pending.Payload) {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return pending, true, nil
+		}
+	}
+
+	return Notification{}, false, r.changed
+}
+
+func waitForListener(ctx context.Context, listener *pq.Listener) error {
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		err := listener.Ping()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("listener did not connect: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
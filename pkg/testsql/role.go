@@ -0,0 +1,288 @@
+package testsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/lib/pq"
+)
+
+var settingNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Role is a login role created within the Container.
+type Role struct {
+	Name             string
+	Password         string
+	ConnectionString string
+}
+
+// RoleOption customizes a Role before it is created.
+type RoleOption func(*roleConfig) error
+
+type roleConfig struct {
+	grants   []string
+	settings [][2]string
+}
+
+// WithGrants grants the given privileges to the Role.
+// Each grant is everything between GRANT and TO, e.g., "SELECT, INSERT ON ALL TABLES IN SCHEMA public".
+func WithGrants(grants ...string) RoleOption {
+	return func(cfg *roleConfig) error {
+		cfg.grants = append(cfg.grants, grants...)
+		return nil
+	}
+}
+
+// WithRoleSetting sets a configuration parameter for every session of the Role.
+// Custom parameters such as `app.tenant_id` can be read by row-level security policies using current_setting.
+func WithRoleSetting(name, value string) RoleOption {
+	return func(cfg *roleConfig) error {
+		if !settingNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid setting name %q", name)
+		}
+		cfg.settings = append(cfg.settings, [2]string{name, value})
+		return nil
+	}
+}
+
+// NewRole creates a login role with the given name and options.
+// The role is neither a superuser nor allowed to bypass row-level security, so policies apply to it.
+func (c *Container) NewRole(name string, opts ...RoleOption) (*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewRoleWithContext(ctx, name, opts...)
+}
+
+// NewRoleWithContext creates a login role with the given name and options.
+// The role is neither a superuser nor allowed to bypass row-level security, so policies apply to it.
+// NewRoleWithContext exists to allow you to customize the connection process, e.g., apply timeout.
+func (c *Container) NewRoleWithContext(ctx context.Context, name string, opts ...RoleOption) (*Role, error) {
+	cfg := roleConfig{}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	connStr, err := url.Parse(c.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	password := common.GenerateId()
+	connStr.User = url.UserPassword(name, password)
+
+	client, err := c.NewClientWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ident := pq.QuoteIdentifier(name)
+	stmts := []string{
+		fmt.Sprintf("CREATE ROLE %s LOGIN NOSUPERUSER NOBYPASSRLS PASSWORD %s", ident, pq.QuoteLiteral(password)),
+	}
+	for _, grant := range cfg.grants {
+		stmts = append(stmts, fmt.Sprintf("GRANT %s TO %s", grant, ident))
+	}
+	for _, setting := range cfg.settings {
+		stmts = append(stmts, fmt.Sprintf("ALTER ROLE %s SET %s = %s", ident, setting[0], pq.QuoteLiteral(setting[1])))
+	}
+
+	// The statements run in one transaction, so a failing grant or setting does not leave the role behind.
+	tx, err := client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &Role{
+		Name:             name,
+		Password:         password,
+		ConnectionString: connStr.String(),
+	}, nil
+}
+
+// NewTestRole creates a login role with a random name within the Container.
+// The role and its privileges are automatically dropped after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func (c *Container) NewTestRole(t *testing.T, opts ...RoleOption) (*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return c.NewTestRoleWithContext(t, ctx, opts...)
+}
+
+// NewTestRoleWithContext creates a login role with a random name within the Container.
+// The role and its privileges are automatically dropped after the test finishes.
+func (c *Container) NewTestRoleWithContext(t *testing.T, ctx context.Context, opts ...RoleOption) (*Role, error) {
+	name := "role_" + strings.ToLower(common.GenerateId())
+
+	role, err := c.NewRoleWithContext(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+
+		if err := c.dropRoleWithContext(ctx, role.Name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return role, nil
+}
+
+// dropRoleWithContext drops everything the role owns or was granted in every database, then the role itself.
+func (c *Container) dropRoleWithContext(ctx context.Context, name string) error {
+	client, err := c.NewClientWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	rows, err := client.QueryContext(ctx, "SELECT datname FROM pg_database WHERE datallowconn")
+	if err != nil {
+		return err
+	}
+	var databases []string
+	for rows.Next() {
+		var database string
+		if err := rows.Scan(&database); err != nil {
+			rows.Close()
+			return err
+		}
+		databases = append(databases, database)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ident := pq.QuoteIdentifier(name)
+	for _, database := range databases {
+		connStr, err := databaseConnectionString(c.ConnectionString, database)
+		if err != nil {
+			return err
+		}
+		if err := c.execWithContext(ctx, connStr, "DROP OWNED BY "+ident); err != nil {
+			return fmt.Errorf("dropping objects of role %s in database %s: %w", name, database, err)
+		}
+	}
+
+	_, err = client.ExecContext(ctx, "DROP ROLE "+ident)
+	return err
+}
+
+// execWithContext runs stmt on a new connection to connStr.
+func (c *Container) execWithContext(ctx context.Context, connStr, stmt string) error {
+	client, err := sql.Open(c.driver, connStr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, err = client.ExecContext(ctx, stmt)
+	return err
+}
+
+// AsRole returns a copy of the Container that connects as the given Role.
+// Every helper of the copy, e.g., NewTestClient, uses the Role's connection string.
+// NewDatabase and NewTestDatabase of the copy create the database as the superuser with the Role as its owner,
+// then run the migrations and connect to it as the Role.
+func (c *Container) AsRole(role *Role) *Container {
+	admin := c
+	if c.admin != nil {
+		admin = c.admin
+	}
+
+	return &Container{
+		Container:        c.Container,
+		ConnectionString: role.ConnectionString,
+		driver:           c.driver,
+		admin:            admin,
+		role:             role.Name,
+	}
+}
+
+// newRoleDatabaseWithContext creates the database name owned by the Role of c as the superuser,
+// then runs the migrations and connects to it as the Role.
+func (c *Container) newRoleDatabaseWithContext(ctx context.Context, name, migrationsFilepath string) (*sql.DB, error) {
+	admin, err := c.admin.NewClientWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	stmt := fmt.Sprintf("CREATE DATABASE %s OWNER %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(c.role))
+	if _, err := admin.ExecContext(ctx, stmt); err != nil {
+		return nil, err
+	}
+
+	connStr, err := databaseConnectionString(c.ConnectionString, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateUp(migrationsFilepath, connStr); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(c.driver, connStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dropRoleDatabase closes db, a client of a database created by newRoleDatabaseWithContext, and drops the database as the superuser.
+func (c *Container) dropRoleDatabase(t testing.TB, db *sql.DB, name string) {
+	if err := db.Close(); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+
+	admin, err := c.admin.NewClientWithContext(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer admin.Close()
+
+	if _, err := admin.ExecContext(ctx, "DROP DATABASE "+pq.QuoteIdentifier(name)); err != nil {
+		t.Error(err)
+	}
+}
+
+// databaseConnectionString returns connStr with its database replaced by the given one.
+func databaseConnectionString(connStr, database string) (string, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/" + database
+	return u.String(), nil
+}
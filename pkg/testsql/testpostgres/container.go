@@ -40,11 +40,6 @@ func makeContainerRequest(opts []options.Option) (cReq tc.ContainerRequest, err
 	}
 
 	/// Apply opts
-	if len(opts) == 0 {
-		/// The caller did not specify a password so let's prevent the container error.
-		opts = append(opts, WithPassword(defaultPassword))
-	}
-
 	for _, opt := range opts {
 		err = opt(&cReq)
 		if err != nil {
@@ -52,6 +47,13 @@ func makeContainerRequest(opts []options.Option) (cReq tc.ContainerRequest, err
 		}
 	}
 
+	_, passwordExists := cReq.Env[env_POSTGRES_PASSWORD]
+	_, authMethodExists := cReq.Env[env_POSTGRES_HOST_AUTH_METHOD]
+	if !passwordExists && !authMethodExists {
+		/// The caller did not specify a password so let's prevent the container error.
+		err = WithPassword(defaultPassword)(&cReq)
+	}
+
 	return
 }
 
@@ -82,6 +84,11 @@ func RunWithContext(ctx context.Context, opts ...options.Option) (con *testsql.C
 		return
 	}
 
+	return startContainer(ctx, cReq)
+}
+
+// startContainer starts a container for the given request and builds its connection string.
+func startContainer(ctx context.Context, cReq tc.ContainerRequest) (con *testsql.Container, err error) {
 	c, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{
 		ContainerRequest: cReq,
 		Started:          true,
@@ -96,6 +103,14 @@ func RunWithContext(ctx context.Context, opts ...options.Option) (con *testsql.C
 		return
 	}
 
+	user, password := credentials(cReq)
+	con = testsql.New(c, driver, fmt.Sprintf("postgres://%s:%s@%s:%s?sslmode=disable", user, password, host, port.Port()))
+
+	return
+}
+
+// credentials returns the superuser name and password configured by cReq.
+func credentials(cReq tc.ContainerRequest) (user, password string) {
 	user, userExists := cReq.Env[env_POSTGRES_USER]
 	if !userExists {
 		user = defaultUser
@@ -106,8 +121,6 @@ func RunWithContext(ctx context.Context, opts ...options.Option) (con *testsql.C
 		password = defaultPassword
 	}
 
-	con = testsql.New(c, driver, fmt.Sprintf("postgres://%s:%s@%s:%s?sslmode=disable", user, password, host, port.Port()))
-
 	return
 }
 
@@ -0,0 +1,118 @@
+package testpostgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/kyleishie/testdeps/pkg/testsql"
+	"github.com/lib/pq"
+)
+
+const defaultOutputPlugin = "pgoutput"
+
+// ReplicationConnectionString returns the connection string of con with `replication=database` set.
+// Connections made with it speak the streaming replication protocol, e.g., for pglogrepl.
+// The Container must be created with the WithLogicalReplication option.
+func ReplicationConnectionString(con *testsql.Container) (string, error) {
+	connStr, err := url.Parse(con.ConnectionString)
+	if err != nil {
+		return "", err
+	}
+
+	query := connStr.Query()
+	query.Set("replication", "database")
+	connStr.RawQuery = query.Encode()
+	return connStr.String(), nil
+}
+
+// NewPublication creates a publication with the given name for the given tables.
+// If no tables are given the publication includes all tables.
+func NewPublication(ctx context.Context, db *sql.DB, name string, tables ...string) error {
+	target := "ALL TABLES"
+	if len(tables) > 0 {
+		quoted := make([]string, 0, len(tables))
+		for _, table := range tables {
+			quoted = append(quoted, pq.QuoteIdentifier(table))
+		}
+		target = "TABLE " + strings.Join(quoted, ", ")
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR %s", pq.QuoteIdentifier(name), target))
+	return err
+}
+
+// NewTestPublication creates a publication with a random name for the given tables and returns its name.
+// If no tables are given the publication includes all tables.
+// The publication is automatically dropped after the test finishes.
+// Note: A default context is used with a timeout of two minutes.
+func NewTestPublication(t testing.TB, db *sql.DB, tables ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return NewTestPublicationWithContext(t, ctx, db, tables...)
+}
+
+// NewTestPublicationWithContext creates a publication with a random name for the given tables and returns its name.
+// If no tables are given the publication includes all tables.
+// The publication is automatically dropped after the test finishes.
+func NewTestPublicationWithContext(t testing.TB, ctx context.Context, db *sql.DB, tables ...string) (string, error) {
+	name := "pub_" + strings.ToLower(common.GenerateId())
+	if err := NewPublication(ctx, db, name, tables...); err != nil {
+		return "", err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if _, err := db.ExecContext(ctx, "DROP PUBLICATION IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return name, nil
+}
+
+// NewReplicationSlot creates a logical replication slot with the given name and output plugin.
+// If plugin is empty `pgoutput` is used.
+func NewReplicationSlot(ctx context.Context, db *sql.DB, name, plugin string) error {
+	if plugin == "" {
+		plugin = defaultOutputPlugin
+	}
+	_, err := db.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, $2)", name, plugin)
+	return err
+}
+
+// NewTestReplicationSlot creates a logical replication slot with a random name and returns its name.
+// If plugin is empty `pgoutput` is used.
+// The slot is automatically dropped after the test finishes so it does not retain WAL.
+// Note: A default context is used with a timeout of two minutes.
+func NewTestReplicationSlot(t testing.TB, db *sql.DB, plugin string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return NewTestReplicationSlotWithContext(t, ctx, db, plugin)
+}
+
+// NewTestReplicationSlotWithContext creates a logical replication slot with a random name and returns its name.
+// If plugin is empty `pgoutput` is used.
+// The slot is automatically dropped after the test finishes so it does not retain WAL.
+// Consumers must be stopped before the slot is dropped, so register them after calling NewTestReplicationSlotWithContext.
+func NewTestReplicationSlotWithContext(t testing.TB, ctx context.Context, db *sql.DB, plugin string) (string, error) {
+	name := "slot_" + strings.ToLower(common.GenerateId())
+	if err := NewReplicationSlot(ctx, db, name, plugin); err != nil {
+		return "", err
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if _, err := db.ExecContext(ctx, "SELECT pg_drop_replication_slot($1)", name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return name, nil
+}
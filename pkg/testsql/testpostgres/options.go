@@ -10,6 +10,7 @@ const (
 	env_POSTGRES_USER             = "POSTGRES_USER"
 	env_POSTGRES_PASSWORD         = "POSTGRES_PASSWORD"
 	env_POSTGRES_DB               = "POSTGRES_DB"
+	env_PGPASSWORD                = "PGPASSWORD"
 )
 
 func WithTrust() options.Option {
@@ -54,3 +55,13 @@ func WithInitialDatabase(dbName string) options.Option {
 		return nil
 	}
 }
+
+// WithLogicalReplication starts the server with wal_level=logical and allows replication connections from any host.
+// This is required to consume logical decoding output, e.g., with pglogrepl, from the host.
+func WithLogicalReplication() options.Option {
+	return func(cr *testcontainers.ContainerRequest) error {
+		cr.Entrypoint = bashEntrypoint(replicationEntrypoint)
+		cr.Cmd = append(cr.Cmd, "-c", "wal_level=logical")
+		return nil
+	}
+}
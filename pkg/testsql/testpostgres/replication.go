@@ -0,0 +1,249 @@
+package testpostgres
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/common"
+	"github.com/kyleishie/testdeps/pkg/options"
+	"github.com/kyleishie/testdeps/pkg/testsql"
+	tc "github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	primaryAlias    = "primary"
+	replicaReadyLog = "database system is ready to accept read-only connections"
+	lsnPollInterval = time.Millisecond * 100
+
+	// replicationEntrypoint installs an init script that allows replication connections from any host
+	// before handing off to the standard postgres entrypoint.
+	replicationEntrypoint = `echo 'echo "host replication all all ${POSTGRES_HOST_AUTH_METHOD:-md5}" >> "$PGDATA/pg_hba.conf"' > /docker-entrypoint-initdb.d/10-replication.sh && exec docker-entrypoint.sh postgres "$@"`
+
+	// replicaEntrypoint clones the primary with pg_basebackup, retrying until the primary accepts connections,
+	// then starts postgres as a hot standby.
+	replicaEntrypoint = `mkdir -p "$PGDATA" && chown postgres "$PGDATA" && chmod 700 "$PGDATA" && ` +
+		`until gosu postgres pg_basebackup --pgdata="$PGDATA" --write-recovery-conf --wal-method=stream --host=` + primaryAlias + ` --username="$POSTGRES_USER"; do sleep 1; done && ` +
+		`exec gosu postgres postgres "$@"`
+)
+
+// Topology is a primary and its streaming replicas running on a shared docker network.
+type Topology struct {
+	Primary  *testsql.Container
+	Replicas []*testsql.Container
+	network  tc.Network
+}
+
+// RunTopology creates and starts a primary and the given number of streaming replicas with the `postgres` image.
+// Every node receives the same options so they run the same image tag and credentials.
+// A default context is used with a timeout of two minutes. To customize use RunTopologyWithContext.
+func RunTopology(replicas int, opts ...options.Option) (*Topology, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunTopologyWithContext(ctx, replicas, opts...)
+}
+
+// RunTopologyWithContext creates and starts a primary and the given number of streaming replicas with the `postgres` image.
+// Every node receives the same options so they run the same image tag and credentials.
+// A context can be provided to configure things such as timeout.
+func RunTopologyWithContext(ctx context.Context, replicas int, opts ...options.Option) (topo *Topology, err error) {
+	if replicas < 1 {
+		return nil, fmt.Errorf("a topology requires at least one replica, got %d", replicas)
+	}
+
+	networkName := "testdeps-" + common.GenerateId()
+	network, err := tc.GenericNetwork(ctx, tc.GenericNetworkRequest{
+		NetworkRequest: tc.NetworkRequest{
+			Name:           networkName,
+			CheckDuplicate: true,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	topo = &Topology{network: network}
+	defer func() {
+		if err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+			defer cancel()
+			_ = topo.Terminate(ctx)
+			topo = nil
+		}
+	}()
+
+	primaryReq, err := makeNodeRequest(opts, networkName, replicationEntrypoint)
+	if err != nil {
+		return
+	}
+	primaryReq.NetworkAliases = map[string][]string{networkName: {primaryAlias}}
+
+	topo.Primary, err = startContainer(ctx, primaryReq)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < replicas; i++ {
+		replicaReq, err := makeNodeRequest(opts, networkName, replicaEntrypoint)
+		if err != nil {
+			return topo, err
+		}
+		replicaReq.WaitingFor = wait.ForLog(replicaReadyLog)
+
+		user, password := credentials(replicaReq)
+		replicaReq.Env[env_POSTGRES_USER] = user
+		replicaReq.Env[env_PGPASSWORD] = password
+
+		replica, err := startContainer(ctx, replicaReq)
+		if err != nil {
+			return topo, err
+		}
+		topo.Replicas = append(topo.Replicas, replica)
+	}
+
+	return
+}
+
+// RunTopologyForTest creates and starts a primary and the given number of streaming replicas with the `postgres` image.
+// All nodes and their network are automatically removed after the test has finished.
+// A default context is used with a timeout of two minutes. To customize use RunTopologyForTestWithContext.
+func RunTopologyForTest(t *testing.T, replicas int, opts ...options.Option) *Topology {
+	ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+	defer cancel()
+	return RunTopologyForTestWithContext(t, ctx, replicas, opts...)
+}
+
+// RunTopologyForTestWithContext creates and starts a primary and the given number of streaming replicas with the `postgres` image.
+// A context can be provided to configure things such as timeout.
+// All nodes and their network are automatically removed after the test has finished.
+func RunTopologyForTestWithContext(t *testing.T, ctx context.Context, replicas int, opts ...options.Option) *Topology {
+	topo, err := RunTopologyWithContext(ctx, replicas, opts...)
+	if err != nil {
+		t.Fatalf("error starting topology: %s", err.Error())
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), common.DefaultConnTimeout)
+		defer cancel()
+		if err := topo.Terminate(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return topo
+}
+
+// ReplicaConnectionStrings returns the connection string of every replica in the order they were started.
+func (topo *Topology) ReplicaConnectionStrings() []string {
+	connStrs := make([]string, 0, len(topo.Replicas))
+	for _, replica := range topo.Replicas {
+		connStrs = append(connStrs, replica.ConnectionString)
+	}
+	return connStrs
+}
+
+// CurrentLSN returns the current write-ahead log location of the primary, e.g., `0/3000148`.
+// Pass the result to WaitForReplicas to wait until writes made so far are visible on every replica.
+func (topo *Topology) CurrentLSN(ctx context.Context) (lsn string, err error) {
+	client, err := topo.Primary.NewClientWithContext(ctx)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	err = client.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn)
+	return
+}
+
+// WaitForReplicas blocks until every replica has replayed the write-ahead log up to the given LSN.
+// Use CurrentLSN to obtain the LSN of the latest write on the primary.
+func (topo *Topology) WaitForReplicas(ctx context.Context, lsn string) error {
+	for _, replica := range topo.Replicas {
+		if err := waitForReplay(ctx, replica, lsn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitForReplicasToCatchUp is a convenience that waits for every replica to replay the primary's CurrentLSN.
+func (topo *Topology) WaitForReplicasToCatchUp(ctx context.Context) error {
+	lsn, err := topo.CurrentLSN(ctx)
+	if err != nil {
+		return err
+	}
+	return topo.WaitForReplicas(ctx, lsn)
+}
+
+// Terminate terminates every node of the Topology and removes its network.
+// Every node is terminated even if another fails to, the first error is returned.
+func (topo *Topology) Terminate(ctx context.Context) error {
+	var firstErr error
+	for _, replica := range topo.Replicas {
+		if err := replica.Terminate(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error terminating replica: %w", err)
+		}
+	}
+
+	if topo.Primary != nil {
+		if err := topo.Primary.Terminate(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error terminating primary: %w", err)
+		}
+	}
+
+	if err := topo.network.Remove(ctx); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error removing network: %w", err)
+	}
+
+	return firstErr
+}
+
+func waitForReplay(ctx context.Context, replica *testsql.Container, lsn string) error {
+	client, err := replica.NewClientWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ticker := time.NewTicker(lsnPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var caughtUp bool
+		err := client.QueryRowContext(ctx, "SELECT coalesce(pg_last_wal_replay_lsn() >= $1::pg_lsn, false)", lsn).Scan(&caughtUp)
+		if err != nil {
+			return err
+		}
+		if caughtUp {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replica did not reach lsn %s: %w", lsn, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// makeNodeRequest builds the container request for a member of a Topology.
+func makeNodeRequest(opts []options.Option, networkName, entrypoint string) (cReq tc.ContainerRequest, err error) {
+	cReq, err = makeContainerRequest(opts)
+	if err != nil {
+		return
+	}
+
+	if cReq.Env == nil {
+		cReq.Env = make(map[string]string)
+	}
+	cReq.Entrypoint = bashEntrypoint(entrypoint)
+	cReq.Networks = []string{networkName}
+	return
+}
+
+// bashEntrypoint runs script with bash, passing the container command as its arguments.
+func bashEntrypoint(script string) []string {
+	return []string{"bash", "-c", script, "--"}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/testsql/testpostgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogicalReplication(t *testing.T) {
+	con := testpostgres.RunForTest(t, testpostgres.WithLogicalReplication())
+
+	db, err := con.NewTestClient(t)
+	assert.NoError(t, err)
+
+	t.Run("wal level", func(t *testing.T) {
+		var level string
+		assert.NoError(t, db.QueryRow("SHOW wal_level").Scan(&level))
+		assert.Equal(t, "logical", level)
+	})
+
+	t.Run("replication connection string", func(t *testing.T) {
+		connStr, err := testpostgres.ReplicationConnectionString(con)
+		assert.NoError(t, err)
+		assert.Contains(t, connStr, "replication=database")
+	})
+
+	t.Run("slot captures changes", func(t *testing.T) {
+		_, err := db.Exec("CREATE TABLE orders (id int primary key, status text)")
+		assert.NoError(t, err)
+
+		pub, err := testpostgres.NewTestPublication(t, db, "orders")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, pub)
+
+		slot, err := testpostgres.NewTestReplicationSlot(t, db, "test_decoding")
+		assert.NoError(t, err)
+
+		_, err = db.Exec("INSERT INTO orders VALUES (1, 'paid')")
+		assert.NoError(t, err)
+
+		rows, err := db.Query("SELECT data FROM pg_logical_slot_get_changes($1, NULL, NULL)", slot)
+		assert.NoError(t, err)
+		defer rows.Close()
+
+		var changes []string
+		for rows.Next() {
+			var data string
+			assert.NoError(t, rows.Scan(&data))
+			changes = append(changes, data)
+		}
+		assert.Contains(t, strings.Join(changes, "\n"), "table public.orders: INSERT")
+	})
+}
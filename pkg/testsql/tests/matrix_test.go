@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/testsql"
+	"github.com/kyleishie/testdeps/pkg/testsql/testpostgres"
+	"github.com/stretchr/testify/assert"
+)
+
+var matrix = testpostgres.NewMatrix([]string{"13", "14"})
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if err := matrix.Terminate(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func TestMatrix_Run(t *testing.T) {
+	t.Run("runs every tag", func(t *testing.T) {
+		var versions []string
+		matrix.Run(t, func(t *testing.T, con *testsql.Container) {
+			db, err := con.NewTestClient(t)
+			assert.NoError(t, err)
+
+			var version string
+			assert.NoError(t, db.QueryRow("SHOW server_version").Scan(&version))
+			versions = append(versions, version)
+		})
+		assert.Len(t, versions, 2)
+	})
+	t.Run("shares containers", func(t *testing.T) {
+		first, err := matrix.Container(context.Background(), "13")
+		assert.NoError(t, err)
+		second, err := matrix.Container(context.Background(), "13")
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+	t.Run("terminates containers", func(t *testing.T) {
+		local := testpostgres.NewMatrix([]string{"13"})
+		first, err := local.Container(context.Background(), "13")
+		assert.NoError(t, err)
+		assert.NoError(t, local.Terminate(context.Background()))
+
+		second, err := local.Container(context.Background(), "13")
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+		assert.NoError(t, local.Terminate(context.Background()))
+	})
+}
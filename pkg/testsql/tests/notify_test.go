@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kyleishie/testdeps/pkg/testsql/testpostgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainer_NewTestNotificationRecorder(t *testing.T) {
+	con := testpostgres.RunForTest(t)
+
+	t.Run("records notifications", func(t *testing.T) {
+		recorder, err := con.NewTestNotificationRecorder(t, "cache")
+		assert.NoError(t, err)
+
+		db, err := con.NewTestClient(t)
+		assert.NoError(t, err)
+
+		_, err = db.Exec("SELECT pg_notify('cache', 'invalidate:users:1')")
+		assert.NoError(t, err)
+
+		n := recorder.ExpectNotification(t, "cache", `^invalidate:users:\d+$`, time.Second*2)
+		assert.Equal(t, "invalidate:users:1", n.Payload)
+		assert.Len(t, recorder.Notifications(), 1)
+	})
+
+	t.Run("expect no notification", func(t *testing.T) {
+		recorder, err := con.NewTestNotificationRecorder(t, "quiet")
+		assert.NoError(t, err)
+		recorder.ExpectNoNotification(t, "quiet", time.Millisecond*200)
+	})
+
+	t.Run("listen after creation", func(t *testing.T) {
+		recorder, err := con.NewTestNotificationRecorder(t)
+		assert.NoError(t, err)
+		assert.NoError(t, recorder.Listen("late"))
+
+		db, err := con.NewTestClient(t)
+		assert.NoError(t, err)
+
+		_, err = db.Exec("NOTIFY late, 'hello'")
+		assert.NoError(t, err)
+
+		recorder.ExpectNotification(t, "late", "hello", time.Second*2)
+	})
+}
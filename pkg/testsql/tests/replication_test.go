@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/testsql/testpostgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopology(t *testing.T) {
+	topo := testpostgres.RunTopologyForTest(t, 2)
+
+	t.Run("connection strings", func(t *testing.T) {
+		assert.NotEmpty(t, topo.Primary.ConnectionString)
+		assert.Len(t, topo.ReplicaConnectionStrings(), 2)
+	})
+
+	t.Run("replicas receive writes", func(t *testing.T) {
+		ctx := context.Background()
+		primary, err := topo.Primary.NewTestClient(t)
+		assert.NoError(t, err)
+
+		_, err = primary.ExecContext(ctx, "CREATE TABLE replicated (id int)")
+		assert.NoError(t, err)
+		_, err = primary.ExecContext(ctx, "INSERT INTO replicated VALUES (1)")
+		assert.NoError(t, err)
+
+		assert.NoError(t, topo.WaitForReplicasToCatchUp(ctx))
+
+		for _, replica := range topo.Replicas {
+			client, err := replica.NewTestClient(t)
+			assert.NoError(t, err)
+
+			var count int
+			assert.NoError(t, client.QueryRowContext(ctx, "SELECT count(*) FROM replicated").Scan(&count))
+			assert.Equal(t, 1, count)
+		}
+	})
+
+	t.Run("replicas are read only", func(t *testing.T) {
+		client, err := topo.Replicas[0].NewTestClient(t)
+		assert.NoError(t, err)
+
+		_, err = client.Exec("CREATE TABLE not_allowed (id int)")
+		assert.Error(t, err)
+	})
+}
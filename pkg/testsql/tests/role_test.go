@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+
+	"github.com/kyleishie/testdeps/pkg/testsql"
+	"github.com/kyleishie/testdeps/pkg/testsql/testpostgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainer_NewTestRole(t *testing.T) {
+	con := testpostgres.RunForTest(t)
+
+	admin, err := con.NewTestClient(t)
+	assert.NoError(t, err)
+
+	for _, stmt := range []string{
+		"CREATE TABLE documents (tenant text, body text)",
+		"INSERT INTO documents VALUES ('a', 'for a'), ('b', 'for b')",
+		"ALTER TABLE documents ENABLE ROW LEVEL SECURITY",
+		"CREATE POLICY tenant_isolation ON documents USING (tenant = current_setting('app.tenant'))",
+	} {
+		_, err := admin.Exec(stmt)
+		assert.NoError(t, err)
+	}
+
+	t.Run("row level security applies", func(t *testing.T) {
+		role, err := con.NewTestRole(t,
+			testsql.WithGrants("SELECT ON documents"),
+			testsql.WithRoleSetting("app.tenant", "a"),
+		)
+		assert.NoError(t, err)
+
+		db, err := con.AsRole(role).NewTestClient(t)
+		assert.NoError(t, err)
+
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT count(*) FROM documents").Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("missing grant is denied", func(t *testing.T) {
+		role, err := con.NewTestRole(t)
+		assert.NoError(t, err)
+
+		db, err := con.AsRole(role).NewTestClient(t)
+		assert.NoError(t, err)
+
+		_, err = db.Exec("INSERT INTO documents VALUES ('a', 'nope')")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid setting name", func(t *testing.T) {
+		role, err := con.NewTestRole(t, testsql.WithRoleSetting("bad name;", "x"))
+		assert.Error(t, err)
+		assert.Nil(t, role)
+	})
+
+	t.Run("failing grant does not leave the role", func(t *testing.T) {
+		_, err := con.NewRole("role_failing_grant", testsql.WithGrants("SELECT ON missing_table"))
+		assert.Error(t, err)
+
+		var exists bool
+		assert.NoError(t, admin.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'role_failing_grant')").Scan(&exists))
+		assert.False(t, exists)
+	})
+
+	t.Run("creates databases owned by the role", func(t *testing.T) {
+		role, err := con.NewTestRole(t)
+		assert.NoError(t, err)
+
+		db := con.AsRole(role).NewTestDatabase(t, "testdata/role_migrations")
+
+		var user, owner string
+		assert.NoError(t, db.QueryRow("SELECT current_user, pg_get_userbyid(datdba) FROM pg_database WHERE datname = current_database()").Scan(&user, &owner))
+		assert.Equal(t, role.Name, user)
+		assert.Equal(t, role.Name, owner)
+
+		_, err = db.Exec("INSERT INTO notes VALUES ('migrated as the role')")
+		assert.NoError(t, err)
+	})
+
+	_, err = admin.Exec("CREATE DATABASE role_grants")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := admin.Exec("DROP DATABASE role_grants")
+		assert.NoError(t, err)
+	})
+
+	var roleName string
+	t.Run("drops grants in every database", func(t *testing.T) {
+		role, err := con.NewTestRole(t)
+		assert.NoError(t, err)
+		roleName = role.Name
+
+		u, err := url.Parse(con.ConnectionString)
+		assert.NoError(t, err)
+		u.Path = "/role_grants"
+		other, err := sql.Open("postgres", u.String())
+		assert.NoError(t, err)
+		defer other.Close()
+
+		for _, stmt := range []string{
+			"CREATE TABLE IF NOT EXISTS granted (id int)",
+			"GRANT SELECT ON granted TO " + role.Name,
+		} {
+			_, err := other.Exec(stmt)
+			assert.NoError(t, err)
+		}
+	})
+
+	var exists bool
+	assert.NoError(t, admin.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", roleName).Scan(&exists))
+	assert.False(t, exists, "role is dropped after the test")
+}
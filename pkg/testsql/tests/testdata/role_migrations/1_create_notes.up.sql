@@ -0,0 +1 @@
+CREATE TABLE notes (body text);